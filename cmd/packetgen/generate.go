@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const header = `// Code generated by packetgen. DO NOT EDIT.
+// Run "go generate" in the repository root after changing packets.
+/* tslint:disable */
+`
+
+// generator builds typescript definitions for go structs
+type generator struct {
+	// tag is the struct tag holding the field names, json for outgoing and mapstructure for incoming
+	tags map[reflect.Type]string
+
+	// named struct types that need an interface
+	interfaces map[string]reflect.Type
+}
+
+func newGenerator() *generator {
+	return &generator{
+		tags:       make(map[reflect.Type]string),
+		interfaces: make(map[string]reflect.Type),
+	}
+}
+
+// Generate creates the typescript packet definitions
+// outgoing packets are sent by the realm, incoming packets are sent by the client
+func Generate(outgoing []interface{}, incoming []interface{}) ([]byte, error) {
+	gen := newGenerator()
+
+	outgoingCodes, err := gen.addPackets(outgoing, "json")
+	if err != nil {
+		return nil, err
+	}
+
+	incomingCodes, err := gen.addPackets(incoming, "mapstructure")
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(header)
+
+	writeEnum(buf, "RealmPacketCode", outgoingCodes)
+	writeEnum(buf, "ClientPacketCode", incomingCodes)
+
+	names := make([]string, 0, len(gen.interfaces))
+	for name := range gen.interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t := gen.interfaces[name]
+		buf.WriteString("\n")
+		fmt.Fprintf(buf, "export interface %s %s\n", name, gen.structType(t, ""))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gen *generator) addPackets(packets []interface{}, tag string) ([]string, error) {
+	codes := make([]string, 0, len(packets))
+	for _, packet := range packets {
+		t := reflect.TypeOf(packet)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, errors.Errorf("packet %s is not a struct", t)
+		}
+
+		err := gen.addType(t, tag)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, t.Name())
+	}
+	sort.Strings(codes)
+	return codes, nil
+}
+
+// addType adds the named struct and all named structs used by it
+func (gen *generator) addType(t reflect.Type, tag string) error {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return gen.addType(t.Elem(), tag)
+	case reflect.Struct:
+	default:
+		return nil
+	}
+
+	if len(t.Name()) > 0 {
+		if other, ok := gen.interfaces[t.Name()]; ok {
+			if other != t {
+				return errors.Errorf("%s and %s have the same name", other.PkgPath(), t.PkgPath())
+			}
+			return nil
+		}
+		gen.interfaces[t.Name()] = t
+		gen.tags[t] = tag
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		err := gen.addType(t.Field(i).Type, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (gen *generator) structType(t reflect.Type, indent string) string {
+	tag := gen.tags[t]
+	if len(tag) == 0 {
+		// anonymous structs don't have a tag of their own
+		tag = "json"
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("{\n")
+	gen.writeFields(buf, t, tag, indent+"    ")
+	buf.WriteString(indent + "}")
+	return buf.String()
+}
+
+func (gen *generator) writeFields(buf *bytes.Buffer, t reflect.Type, tag string, indent string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 {
+			// unexported
+			continue
+		}
+
+		name, options := parseTag(field.Tag.Get(tag))
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && len(name) == 0 && field.Type.Kind() == reflect.Struct {
+			// embedded structs are flattened
+			gen.writeFields(buf, field.Type, tag, indent)
+			continue
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		optional := ""
+		if strings.Contains(options, "omitempty") {
+			optional = "?"
+		}
+
+		fmt.Fprintf(buf, "%s%s%s: %s;\n", indent, name, optional, gen.tsType(field.Type, tag, indent))
+	}
+}
+
+func (gen *generator) tsType(t reflect.Type, tag string, indent string) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Ptr:
+		return gen.tsType(t.Elem(), tag, indent) + " | null"
+	case reflect.Slice, reflect.Array:
+		elem := gen.tsType(t.Elem(), tag, indent)
+		if strings.Contains(elem, " ") && !strings.HasPrefix(elem, "{") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("{ [key: string]: %s }", gen.tsType(t.Elem(), tag, indent))
+	case reflect.Struct:
+		if len(t.Name()) > 0 {
+			return t.Name()
+		}
+		if _, ok := gen.tags[t]; !ok {
+			gen.tags[t] = tag
+		}
+		return gen.structType(t, indent)
+	default:
+		return "any"
+	}
+}
+
+func parseTag(tag string) (string, string) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+func writeEnum(buf *bytes.Buffer, name string, codes []string) {
+	buf.WriteString("\n")
+	fmt.Fprintf(buf, "export enum %s {\n", name)
+	for _, code := range codes {
+		fmt.Fprintf(buf, "    %s = \"%s\",\n", code, code)
+	}
+	buf.WriteString("}\n")
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestGeneratedPacketsAreUpToDate(t *testing.T) {
+	expected, err := Generate(packets())
+	if err != nil {
+		t.Fatalf("Error generating packets: %s", err.Error())
+	}
+
+	actual, err := ioutil.ReadFile("../../public/src/packets.ts")
+	if err != nil {
+		t.Fatalf("Error reading packets: %s", err.Error())
+	}
+
+	if string(expected) != string(actual) {
+		t.Fatalf("public/src/packets.ts is out of date, run go generate in the repository root")
+	}
+}
@@ -0,0 +1,40 @@
+// packetgen generates the typescript definitions of the packets sent between the realm and the web client
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+
+	"github.com/namelessmmo/realm/pkg/server/client"
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+	"github.com/sirupsen/logrus"
+)
+
+func packets() ([]interface{}, []interface{}) {
+	outgoingPackets := make([]interface{}, 0, len(outgoing.Packets))
+	for _, packet := range outgoing.Packets {
+		outgoingPackets = append(outgoingPackets, packet)
+	}
+
+	incomingPackets := make([]interface{}, 0)
+	for _, packet := range client.RegisteredIncomingPackets() {
+		incomingPackets = append(incomingPackets, packet)
+	}
+
+	return outgoingPackets, incomingPackets
+}
+
+func main() {
+	out := flag.String("out", "public/src/packets.ts", "The typescript file to write")
+	flag.Parse()
+
+	data, err := Generate(packets())
+	if err != nil {
+		logrus.Fatalf("Error generating packets: %s", err.Error())
+	}
+
+	err = ioutil.WriteFile(*out, data, 0644)
+	if err != nil {
+		logrus.Fatalf("Error writing %s: %s", *out, err.Error())
+	}
+}
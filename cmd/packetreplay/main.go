@@ -0,0 +1,113 @@
+// packetreplay sends the client packets of a capture to a realm and prints what the realm sends back
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/namelessmmo/realm/pkg/server/client"
+	"github.com/sirupsen/logrus"
+)
+
+func readCapture(name string) ([]*client.CapturedPacket, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	packets := make([]*client.CapturedPacket, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024) // world data can be large
+	for scanner.Scan() {
+		packet := &client.CapturedPacket{}
+		err := json.Unmarshal(scanner.Bytes(), packet)
+		if err != nil {
+			return nil, err
+		}
+		if packet.Direction == client.CaptureIncoming {
+			packets = append(packets, packet)
+		}
+	}
+
+	return packets, scanner.Err()
+}
+
+func main() {
+	captureFile := flag.String("capture", "", "The capture file to replay")
+	url := flag.String("url", "ws://localhost:8080/ws", "The realm websocket url")
+	token := flag.String("token", "", "The access token to login with, captures don't contain the original token")
+	speed := flag.Float64("speed", 1, "Replay speed multiplier")
+	wait := flag.Duration("wait", 2*time.Second, "How long to keep reading after the last packet was sent")
+	flag.Parse()
+
+	if len(*captureFile) == 0 || len(*token) == 0 {
+		logrus.Fatalf("capture and token are required")
+	}
+
+	packets, err := readCapture(*captureFile)
+	if err != nil {
+		logrus.Fatalf("Error reading capture: %s", err.Error())
+	}
+	if len(packets) == 0 || packets[0].Code != "PlayerLogin" {
+		logrus.Fatalf("Capture does not start with a PlayerLogin packet")
+	}
+
+	login, _ := packets[0].Data.(map[string]interface{})
+	if login == nil {
+		login = make(map[string]interface{})
+		packets[0].Data = login
+	}
+	login["access_token"] = *token
+	login["resume_token"] = ""
+	login["codec"] = client.JSONCodecName // keep the output readable
+
+	connection, _, err := websocket.DefaultDialer.Dial(*url, nil)
+	if err != nil {
+		logrus.Fatalf("Error connecting to %s: %s", *url, err.Error())
+	}
+	defer connection.Close()
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, message, err := connection.ReadMessage()
+			if err != nil {
+				logrus.Infof("Connection closed: %s", err.Error())
+				return
+			}
+			fmt.Printf("%10s < %s\n", time.Since(start).Truncate(time.Millisecond), message)
+		}
+	}()
+
+	captureStart := packets[0].Time
+	for i, packet := range packets {
+		at := time.Duration(float64(packet.Time.Sub(captureStart)) / *speed)
+		time.Sleep(time.Until(start.Add(at)))
+
+		data, _ := packet.Data.(map[string]interface{})
+		err := connection.WriteJSON(&client.RawIncomingPacket{Code: packet.Code, Data: data})
+		if err != nil {
+			logrus.Fatalf("Error sending %s: %s", packet.Code, err.Error())
+		}
+		if i == 0 {
+			// don't print the token
+			fmt.Printf("%10s > %s\n", time.Since(start).Truncate(time.Millisecond), packet.Code)
+			continue
+		}
+		fmt.Printf("%10s > %s %v\n", time.Since(start).Truncate(time.Millisecond), packet.Code, packet.Data)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(*wait):
+		_ = connection.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}
+}
@@ -1,7 +1,18 @@
+//go:generate go run ./cmd/packetgen -out public/src/packets.ts
+
 package main
 
-import "github.com/namelessmmo/realm/pkg/server"
+import (
+	"os"
+
+	"github.com/namelessmmo/realm/pkg/server"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		server.RunTokenCommand(os.Args[2:])
+		return
+	}
+
 	server.NewServer().Run()
 }
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Ban keeps an account or a single access token out of the realm
+type Ban struct {
+	// Username bans the account, TokenID bans a single token by its jti claim
+	Username string `json:"username,omitempty"`
+	TokenID  string `json:"token_id,omitempty"`
+
+	Reason string `json:"reason,omitempty"`
+
+	// Until is when the ban expires, nil is permanent
+	Until *time.Time `json:"until,omitempty"`
+}
+
+func (ban *Ban) active(now time.Time) bool {
+	return ban.Until == nil || now.Before(*ban.Until)
+}
+
+func (ban *Ban) matches(username string, tokenID string) bool {
+	if len(ban.Username) > 0 && ban.Username == username {
+		return true
+	}
+	return len(ban.TokenID) > 0 && ban.TokenID == tokenID
+}
+
+// Message is the reason shown to the banned player
+func (ban *Ban) Message() string {
+	message := "You are permanently banned from this realm"
+	if ban.Until != nil {
+		message = fmt.Sprintf("You are banned from this realm until %s", ban.Until.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	if len(ban.Reason) > 0 {
+		message += ": " + ban.Reason
+	}
+	return message
+}
+
+// BanStore finds the bans for players logging in
+type BanStore interface {
+	// FindBan returns the active ban for the username or token id, nil if there is none
+	FindBan(username string, tokenID string) (*Ban, error)
+}
+
+// FileBanStore reads bans from a json file
+//
+//	{
+//	  "bans": [
+//	    {"username": "griefer", "reason": "Griefing", "until": "2019-05-01T00:00:00Z"},
+//	    {"token_id": "5c9d1f0e"}
+//	  ]
+//	}
+type FileBanStore struct {
+	path string
+
+	lock    sync.RWMutex
+	bans    []*Ban
+	modTime time.Time
+}
+
+// LoadFileBanStore reads the bans in the file
+// a missing file has no bans so it can be created once somebody needs to be banned
+func LoadFileBanStore(path string) (*FileBanStore, error) {
+	store := &FileBanStore{path: path}
+	err := store.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Reload reads the ban file again, the current bans are kept if it can't be read
+func (store *FileBanStore) Reload() error {
+	info, err := os.Stat(store.path)
+	if os.IsNotExist(err) {
+		store.lock.Lock()
+		defer store.lock.Unlock()
+		store.bans = nil
+		store.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error reading ban file")
+	}
+
+	data, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		return errors.Wrap(err, "Error reading ban file")
+	}
+
+	file := &struct {
+		Bans []*Ban `json:"bans"`
+	}{}
+	err = json.Unmarshal(data, file)
+	if err != nil {
+		return errors.Wrapf(err, "Error parsing ban file %s", store.path)
+	}
+
+	for i, ban := range file.Bans {
+		if len(ban.Username) == 0 && len(ban.TokenID) == 0 {
+			return errors.Errorf("Ban %d in %s has no username or token_id", i, store.path)
+		}
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.bans = file.Bans
+	store.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the ban file every interval when it has changed
+func (store *FileBanStore) Watch(interval time.Duration) {
+	reload(store.path, interval, store.getModTime, store.Reload)
+}
+
+func (store *FileBanStore) getModTime() time.Time {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.modTime
+}
+
+func (store *FileBanStore) FindBan(username string, tokenID string) (*Ban, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	now := time.Now()
+	var found *Ban
+	for _, ban := range store.bans {
+		if !ban.active(now) || !ban.matches(username, tokenID) {
+			continue
+		}
+
+		// the ban lasting the longest is shown to the player
+		if found == nil || ban.Until == nil || (found.Until != nil && ban.Until.After(*found.Until)) {
+			found = ban
+		}
+	}
+	return found, nil
+}
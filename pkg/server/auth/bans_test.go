@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileBanStoreFindBan(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	soon := time.Now().Add(time.Hour)
+	later := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		bans     []*Ban
+		username string
+		tokenID  string
+		found    string // reason of the ban that is found, empty when there is none
+	}{
+		{name: "no bans", username: "player"},
+		{name: "username ban", bans: []*Ban{{Username: "player", Reason: "account"}}, username: "player", found: "account"},
+		{name: "token ban", bans: []*Ban{{TokenID: "jti", Reason: "token"}}, username: "player", tokenID: "jti", found: "token"},
+		{name: "other players are not banned", bans: []*Ban{{Username: "griefer"}, {TokenID: "jti"}}, username: "player", tokenID: "other"},
+		{name: "username bans only match the username", bans: []*Ban{{Username: "player"}}, username: "other"},
+		{name: "expired bans are ignored", bans: []*Ban{{Username: "player", Until: &past}}, username: "player"},
+		{name: "bans expiring later are active", bans: []*Ban{{Username: "player", Until: &soon, Reason: "soon"}}, username: "player", found: "soon"},
+		{
+			name:     "the ban lasting the longest is found",
+			bans:     []*Ban{{Username: "player", Until: &soon, Reason: "soon"}, {TokenID: "jti", Until: &later, Reason: "later"}, {Username: "player", Until: &past, Reason: "past"}},
+			username: "player",
+			tokenID:  "jti",
+			found:    "later",
+		},
+		{
+			name:     "permanent bans last longer than any other",
+			bans:     []*Ban{{Username: "player", Until: &soon, Reason: "soon"}, {Username: "player", Reason: "permanent"}, {TokenID: "jti", Until: &later, Reason: "later"}},
+			username: "player",
+			tokenID:  "jti",
+			found:    "permanent",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "bans")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(map[string][]*Ban{"bans": test.bans})
+			if err != nil {
+				t.Fatalf("Error encoding bans: %s", err.Error())
+			}
+			path := filepath.Join(dir, "bans.json")
+			err = ioutil.WriteFile(path, data, 0600)
+			if err != nil {
+				t.Fatalf("Error writing ban file: %s", err.Error())
+			}
+
+			store, err := LoadFileBanStore(path)
+			if err != nil {
+				t.Fatalf("Error loading ban file: %s", err.Error())
+			}
+
+			ban, err := store.FindBan(test.username, test.tokenID)
+			if err != nil {
+				t.Fatalf("Error finding ban: %s", err.Error())
+			}
+			if (ban == nil) != (len(test.found) == 0) || (ban != nil && ban.Reason != test.found) {
+				t.Fatalf("expected ban %q, got %+v", test.found, ban)
+			}
+		})
+	}
+}
+
+func TestLoadFileBanStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string // empty when the file doesn't exist
+		invalid bool
+	}{
+		{name: "missing file has no bans"},
+		{name: "ban without a username or token id", file: `{"bans": [{"reason": "nobody"}]}`, invalid: true},
+		{name: "invalid json", file: `{"bans": [`, invalid: true},
+	}
+
+	dir, err := ioutil.TempDir("", "bans")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("bans%d.json", i))
+			if len(test.file) > 0 {
+				err := ioutil.WriteFile(path, []byte(test.file), 0600)
+				if err != nil {
+					t.Fatalf("Error writing ban file: %s", err.Error())
+				}
+			}
+
+			store, err := LoadFileBanStore(path)
+			if (err != nil) != test.invalid {
+				t.Fatalf("expected invalid to be %v, got %v", test.invalid, err)
+			}
+			if err != nil {
+				return
+			}
+
+			ban, _ := store.FindBan("player", "jti")
+			if ban != nil {
+				t.Fatalf("expected no bans, got %+v", ban)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// Claims are the claims of an access token
+type Claims struct {
+	jwt.StandardClaims
+
+	// Audience replaces the aud claim of StandardClaims which can only be a string
+	Audience Audience `json:"aud,omitempty"`
+
+	// Roles grant the player permissions in the realm
+	Roles []string `json:"roles,omitempty"`
+}
+
+// VerifyAudience checks the aud claim, a token for several audiences matches any of them
+func (claims *Claims) VerifyAudience(audience string, required bool) bool {
+	if len(claims.Audience) == 0 {
+		return !required
+	}
+	for _, claimed := range claims.Audience {
+		if claimed == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Audience is the aud claim, a single string or an array of strings
+type Audience []string
+
+// MarshalJSON writes a single audience as a string
+func (audience Audience) MarshalJSON() ([]byte, error) {
+	if len(audience) == 1 {
+		return json.Marshal(audience[0])
+	}
+	return json.Marshal([]string(audience))
+}
+
+func (audience *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*audience = Audience{single}
+		return nil
+	}
+
+	var list []string
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*audience = list
+	return nil
+}
+
+// NewClaims creates the claims for a token that expires after the duration
+// every token gets a random id so it can be banned on its own
+func NewClaims(username string, roles []string, expiry time.Duration) (*Claims, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating token id")
+	}
+
+	now := time.Now()
+	return &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        hex.EncodeToString(id),
+			Subject:   username,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiry).Unix(),
+		},
+		Roles: roles,
+	}, nil
+}
+
+// MintToken signs the claims with the key, the key id is set in the kid header
+func MintToken(key *HMACKey, claims *Claims) (string, error) {
+	if key.verifyOnly() {
+		return "", errors.Errorf("Key %q is verify-only", key.ID)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if len(key.ID) > 0 {
+		token.Header["kid"] = key.ID
+	}
+
+	signed, err := token.SignedString([]byte(key.Secret))
+	if err != nil {
+		return "", errors.Wrap(err, "Error signing token")
+	}
+	return signed, nil
+}
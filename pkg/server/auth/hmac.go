@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// HMACKey is a shared secret used to sign and verify access tokens
+type HMACKey struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+
+	// VerifyUntil makes the key verify-only, tokens signed with it are accepted until then
+	// this keeps players logged in while the auth service switches to a new key
+	VerifyUntil *time.Time `json:"verify_until,omitempty"`
+}
+
+func (key *HMACKey) verifyOnly() bool {
+	return key.VerifyUntil != nil
+}
+
+func (key *HMACKey) canVerify(now time.Time) bool {
+	return key.VerifyUntil == nil || now.Before(*key.VerifyUntil)
+}
+
+// HMACKeySet holds the shared secrets for access tokens, selected by the kid header of the token
+//
+//	{
+//	  "keys": [
+//	    {"id": "2019-04", "secret": "..."},
+//	    {"id": "2019-03", "secret": "...", "verify_until": "2019-04-08T00:00:00Z"}
+//	  ]
+//	}
+type HMACKeySet struct {
+	path string
+
+	lock    sync.RWMutex
+	keys    []*HMACKey
+	modTime time.Time
+}
+
+// NewHMACKeySet creates a key set that is not backed by a file
+func NewHMACKeySet(keys ...*HMACKey) (*HMACKeySet, error) {
+	err := validateHMACKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	return &HMACKeySet{keys: keys}, nil
+}
+
+// LoadHMACKeySet reads the keys in the json file
+func LoadHMACKeySet(path string) (*HMACKeySet, error) {
+	set := &HMACKeySet{path: path}
+	err := set.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Reload reads the key file again, the current keys are kept if it can't be read
+func (set *HMACKeySet) Reload() error {
+	if len(set.path) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(set.path)
+	if err != nil {
+		return errors.Wrap(err, "Error reading key file")
+	}
+
+	data, err := ioutil.ReadFile(set.path)
+	if err != nil {
+		return errors.Wrap(err, "Error reading key file")
+	}
+
+	file := &struct {
+		Keys []*HMACKey `json:"keys"`
+	}{}
+	err = json.Unmarshal(data, file)
+	if err != nil {
+		return errors.Wrapf(err, "Error parsing key file %s", set.path)
+	}
+
+	err = validateHMACKeys(file.Keys)
+	if err != nil {
+		return errors.Wrapf(err, "Error parsing key file %s", set.path)
+	}
+
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	set.keys = file.Keys
+	set.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the key file every interval when it has changed
+func (set *HMACKeySet) Watch(interval time.Duration) {
+	if len(set.path) == 0 {
+		return
+	}
+	reload(set.path, interval, set.getModTime, set.Reload)
+}
+
+func (set *HMACKeySet) getModTime() time.Time {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	return set.modTime
+}
+
+// Key returns the key with the id if it can still verify tokens
+// an empty kid matches the only key in the set and a key without an id matches any kid,
+// so a realm using hmac-auth-string keeps accepting tokens once the auth service adds kid
+func (set *HMACKeySet) Key(kid string) (*HMACKey, bool) {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+
+	now := time.Now()
+	if len(kid) == 0 && len(set.keys) == 1 {
+		key := set.keys[0]
+		return key, key.canVerify(now)
+	}
+
+	var unnamed *HMACKey
+	for _, key := range set.keys {
+		if key.ID == kid {
+			return key, key.canVerify(now)
+		}
+		if len(key.ID) == 0 {
+			unnamed = key
+		}
+	}
+	if unnamed != nil {
+		return unnamed, unnamed.canVerify(now)
+	}
+	return nil, false
+}
+
+// SigningKey returns the first key that is not verify-only
+func (set *HMACKeySet) SigningKey() (*HMACKey, bool) {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+
+	for _, key := range set.keys {
+		if !key.verifyOnly() {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Keyfunc returns the secret that verifies the token, for use with jwt.Parse
+func (set *HMACKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := set.Key(kid)
+	if !ok {
+		return nil, fmt.Errorf("Unknown or expired key id %q", kid)
+	}
+	return []byte(key.Secret), nil
+}
+
+func validateHMACKeys(keys []*HMACKey) error {
+	if len(keys) == 0 {
+		return errors.New("No keys")
+	}
+
+	ids := make(map[string]bool)
+	for _, key := range keys {
+		if len(key.Secret) == 0 {
+			return errors.Errorf("Key %q has no secret", key.ID)
+		}
+		if ids[key.ID] {
+			return errors.Errorf("Duplicate key id %q", key.ID)
+		}
+		ids[key.ID] = true
+	}
+	return nil
+}
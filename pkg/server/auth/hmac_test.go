@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestHMACKeySetKey(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	current := &HMACKey{ID: "current", Secret: "current-secret"}
+	rotated := &HMACKey{ID: "rotated", Secret: "rotated-secret", VerifyUntil: &future}
+	expired := &HMACKey{ID: "expired", Secret: "expired-secret", VerifyUntil: &past}
+	unnamed := &HMACKey{Secret: "hmac-auth-string"}
+
+	tests := []struct {
+		name  string
+		keys  []*HMACKey
+		kid   string
+		found *HMACKey // the key that verifies, nil when none does
+	}{
+		{name: "kid selects the key", keys: []*HMACKey{current, rotated}, kid: "current", found: current},
+		{name: "verify-only keys verify until verify_until", keys: []*HMACKey{current, rotated}, kid: "rotated", found: rotated},
+		{name: "verify-only keys stop verifying after verify_until", keys: []*HMACKey{current, expired}, kid: "expired"},
+		{name: "unknown kid", keys: []*HMACKey{current, rotated}, kid: "missing"},
+		{name: "empty kid matches the only key", keys: []*HMACKey{current}, found: current},
+		{name: "empty kid matches nothing when there are several keys", keys: []*HMACKey{current, rotated}},
+		{name: "empty kid doesn't match an expired only key", keys: []*HMACKey{expired}},
+		{name: "key without an id matches any kid", keys: []*HMACKey{unnamed}, kid: "2019-04", found: unnamed},
+		{name: "key without an id matches an empty kid", keys: []*HMACKey{unnamed}, found: unnamed},
+		{name: "kid prefers the key with the id over a key without an id", keys: []*HMACKey{unnamed, current}, kid: "current", found: current},
+		{name: "key without an id matches unknown kids next to other keys", keys: []*HMACKey{unnamed, current}, kid: "missing", found: unnamed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := NewHMACKeySet(test.keys...)
+			if err != nil {
+				t.Fatalf("Error creating key set: %s", err.Error())
+			}
+
+			key, ok := set.Key(test.kid)
+			if ok != (test.found != nil) || (ok && key != test.found) {
+				t.Fatalf("expected key %v, got %v %v", test.found, key, ok)
+			}
+
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "player"})
+			if len(test.kid) > 0 {
+				token.Header["kid"] = test.kid
+			}
+			secret, err := set.Keyfunc(token)
+			if ok != (err == nil) || (ok && string(secret.([]byte)) != key.Secret) {
+				t.Fatalf("expected Keyfunc to match Key, got %v %v", secret, err)
+			}
+		})
+	}
+}
+
+func TestHMACKeySetSigningKey(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		keys  []*HMACKey
+		found string
+	}{
+		{name: "first key that is not verify-only", keys: []*HMACKey{{ID: "old", Secret: "a", VerifyUntil: &future}, {ID: "new", Secret: "b"}}, found: "new"},
+		{name: "no signing key when all keys are verify-only", keys: []*HMACKey{{ID: "old", Secret: "a", VerifyUntil: &future}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := NewHMACKeySet(test.keys...)
+			if err != nil {
+				t.Fatalf("Error creating key set: %s", err.Error())
+			}
+
+			key, ok := set.SigningKey()
+			if ok != (len(test.found) > 0) || (ok && key.ID != test.found) {
+				t.Fatalf("expected signing key %q, got %v %v", test.found, key, ok)
+			}
+		})
+	}
+}
+
+func TestLoadHMACKeySet(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		kid     string
+		invalid bool
+	}{
+		{name: "keys with verify_until", file: `{"keys": [{"id": "new", "secret": "a"}, {"id": "old", "secret": "b", "verify_until": "2999-01-01T00:00:00Z"}]}`, kid: "old"},
+		{name: "no keys", file: `{"keys": []}`, invalid: true},
+		{name: "key without a secret", file: `{"keys": [{"id": "new"}]}`, invalid: true},
+		{name: "duplicate key ids", file: `{"keys": [{"id": "new", "secret": "a"}, {"id": "new", "secret": "b"}]}`, invalid: true},
+	}
+
+	dir, err := ioutil.TempDir("", "hmac")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "keys.json")
+			err := ioutil.WriteFile(path, []byte(test.file), 0600)
+			if err != nil {
+				t.Fatalf("Error writing key file: %s", err.Error())
+			}
+
+			set, err := LoadHMACKeySet(path)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("expected an error loading the key file")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error loading key file: %s", err.Error())
+			}
+
+			if _, ok := set.Key(test.kid); !ok {
+				t.Fatalf("expected key %q to verify", test.kid)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// jwk is a single key of a JSON Web Key Set, RFC 7517
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// parseJWKS reads the signing keys in the JWKS data
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	set := &jwks{}
+	err := json.Unmarshal(data, set)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling JWKS")
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		switch k.KeyType {
+		case "RSA":
+			key, err = k.rsaKey()
+		case "EC":
+			key, err = k.ecdsaKey()
+		default:
+			// other key types can't verify RS256 or ES256 tokens
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing key %q", k.KeyID)
+		}
+
+		if _, ok := keys[k.KeyID]; ok {
+			return nil, errors.Errorf("Duplicate key id %q", k.KeyID)
+		}
+		keys[k.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error decoding n")
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error decoding e")
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, errors.New("Exponent is too large")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k *jwk) ecdsaKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Curve {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, errors.Errorf("Unsupported curve %s", k.Curve)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error decoding x")
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error decoding y")
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("Point is not on the curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// decodeBigInt decodes a base64url encoded unsigned big endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("Value is empty")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
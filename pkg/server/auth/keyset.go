@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// KeySet holds the public keys used to verify access tokens signed by the auth service
+// keys are read from a PEM or JWKS file and selected by the kid header of the token
+type KeySet struct {
+	path string
+
+	lock    sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	modTime time.Time
+}
+
+// LoadKeySet reads the public keys in the file
+// files starting with { are read as a JWKS, anything else as PEM blocks
+func LoadKeySet(path string) (*KeySet, error) {
+	set := &KeySet{path: path}
+	err := set.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Reload reads the key file again, the current keys are kept if it can't be read
+func (set *KeySet) Reload() error {
+	info, err := os.Stat(set.path)
+	if err != nil {
+		return errors.Wrap(err, "Error reading key file")
+	}
+
+	data, err := ioutil.ReadFile(set.path)
+	if err != nil {
+		return errors.Wrap(err, "Error reading key file")
+	}
+
+	var keys map[string]crypto.PublicKey
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		keys, err = parseJWKS(data)
+	} else {
+		keys, err = parsePEM(data)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Error parsing key file %s", set.path)
+	}
+	if len(keys) == 0 {
+		return errors.Errorf("Key file %s has no keys", set.path)
+	}
+
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	set.keys = keys
+	set.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the key file every interval when it has changed
+func (set *KeySet) Watch(interval time.Duration) {
+	reload(set.path, interval, set.getModTime, set.Reload)
+}
+
+func (set *KeySet) getModTime() time.Time {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	return set.modTime
+}
+
+// Key returns the public key with the kid
+// an empty kid matches the only key in the set
+func (set *KeySet) Key(kid string) (crypto.PublicKey, bool) {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+
+	if len(kid) == 0 && len(set.keys) == 1 {
+		for _, key := range set.keys {
+			return key, true
+		}
+	}
+
+	key, ok := set.keys[kid]
+	return key, ok
+}
+
+// Keyfunc returns the key that verifies the token, for use with jwt.Parse
+// the key type must match the signing method so an RSA key can't be used for ES256
+func (set *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := set.Key(kid)
+	if !ok {
+		return nil, fmt.Errorf("Unknown key id %q", kid)
+	}
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if _, ok := key.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if _, ok := key.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Key %q can't verify signing method %v", kid, token.Header["alg"])
+}
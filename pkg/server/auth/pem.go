@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// pemKeyIDHeader is the PEM block header holding the key id
+//
+//	-----BEGIN PUBLIC KEY-----
+//	kid: 2019-03
+//
+//	MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA...
+//	-----END PUBLIC KEY-----
+const pemKeyIDHeader = "kid"
+
+// parsePEM reads the public keys and certificates in the PEM data
+// a block without a kid header can only be used when it is the only key
+func parsePEM(data []byte) (map[string]crypto.PublicKey, error) {
+	keys := make(map[string]crypto.PublicKey)
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			// private keys and anything else do not belong in the file
+			return nil, errors.Errorf("Unsupported PEM block %s", block.Type)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing PEM block %s", block.Type)
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, errors.Errorf("Unsupported public key type %T", key)
+		}
+
+		kid := block.Headers[pemKeyIDHeader]
+		if _, ok := keys[kid]; ok {
+			return nil, errors.Errorf("Duplicate key id %q", kid)
+		}
+		keys[kid] = key
+	}
+
+	return keys, nil
+}
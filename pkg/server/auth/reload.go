@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reload calls load every interval when the modification time of the file is not current
+// a missing file has a zero modification time
+func reload(path string, interval time.Duration, current func() time.Time, load func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			var modTime time.Time
+			info, err := os.Stat(path)
+			if err == nil {
+				modTime = info.ModTime()
+			} else if !os.IsNotExist(err) {
+				logrus.WithError(err).Errorf("Error checking file %s", path)
+				continue
+			}
+			if modTime.Equal(current()) {
+				continue
+			}
+
+			err = load()
+			if err != nil {
+				logrus.WithError(err).Errorf("Error reloading %s, keeping the current contents", path)
+				continue
+			}
+			logrus.Infof("Reloaded %s", path)
+		}
+	}()
+}
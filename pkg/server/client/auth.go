@@ -0,0 +1,107 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/namelessmmo/realm/pkg/server/auth"
+)
+
+// DefaultTokenLeeway is the clock skew allowed between the realm and the auth service
+const DefaultTokenLeeway = 30 * time.Second
+
+// TokenValidation are the claims an access token must have to log into the realm
+type TokenValidation struct {
+	// Issuer is the expected iss claim, empty allows any issuer
+	Issuer string
+
+	// Audience is the expected aud claim, empty allows any audience
+	Audience string
+
+	// Leeway is the clock skew allowed when checking exp, nbf and iat
+	Leeway time.Duration
+}
+
+// signing methods accepted for access tokens
+var validSigningMethods = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodHS384.Alg(),
+	jwt.SigningMethodHS512.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+}
+
+// authenticate returns the claims of the player logging in
+// dev logins only need a username and are only accepted when the realm allows them
+func (c *Client) authenticate(playerLogin *PlayerLogin) (*auth.Claims, error) {
+	if len(playerLogin.AccessToken) == 0 && len(playerLogin.Username) > 0 {
+		if c.clientHandler.DevLogin == false {
+			return nil, &DisconnectError{Code: http.StatusUnauthorized, Message: "An access token is required"}
+		}
+
+		c.Log.WithField("client_username", playerLogin.Username).Warnf("Dev login without an access token")
+		return &auth.Claims{StandardClaims: jwt.StandardClaims{Subject: playerLogin.Username}}, nil
+	}
+
+	return c.parseAccessToken(playerLogin.AccessToken)
+}
+
+// parseAccessToken verifies the access token sent in PlayerLogin and returns its claims
+// the returned error is a DisconnectError with the reason shown to the player
+func (c *Client) parseAccessToken(accessToken string) (*auth.Claims, error) {
+	// claims are validated below so the leeway can be applied
+	parser := &jwt.Parser{
+		ValidMethods:         validSigningMethods,
+		SkipClaimsValidation: true,
+	}
+
+	token, err := parser.ParseWithClaims(accessToken, &auth.Claims{}, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if c.clientHandler.HMACKeys == nil {
+				return nil, fmt.Errorf("HMAC tokens are not accepted")
+			}
+			return c.clientHandler.HMACKeys.Keyfunc(token)
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+			if c.clientHandler.PublicKeys == nil {
+				return nil, fmt.Errorf("Public key tokens are not accepted")
+			}
+			return c.clientHandler.PublicKeys.Keyfunc(token)
+		default:
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+	})
+	if err != nil {
+		c.Log.Errorf("Error parsing token %s", err.Error())
+		return nil, &DisconnectError{Code: http.StatusUnauthorized, Message: "Error parsing token"}
+	}
+
+	claims := token.Claims.(*auth.Claims)
+	validation := c.clientHandler.TokenValidation
+	leeway := int64(validation.Leeway.Seconds())
+	now := time.Now().Unix()
+
+	if claims.VerifyExpiresAt(now-leeway, true) == false {
+		return nil, &DisconnectError{Code: http.StatusUnauthorized, Message: "Login session expired"}
+	}
+
+	if claims.VerifyNotBefore(now+leeway, false) == false || claims.VerifyIssuedAt(now+leeway, false) == false {
+		return nil, &DisconnectError{Code: http.StatusUnauthorized, Message: "Login session is not valid yet"}
+	}
+
+	if len(validation.Issuer) > 0 && claims.VerifyIssuer(validation.Issuer, true) == false {
+		return nil, &DisconnectError{Code: http.StatusUnauthorized, Message: "Token was not issued for this realm"}
+	}
+
+	if len(validation.Audience) > 0 && claims.VerifyAudience(validation.Audience, true) == false {
+		return nil, &DisconnectError{Code: http.StatusUnauthorized, Message: "Token was not issued for this realm"}
+	}
+
+	if len(claims.Subject) == 0 {
+		return nil, &DisconnectError{Code: http.StatusUnauthorized, Message: "Token has no username"}
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/namelessmmo/realm/pkg/server/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// newAuthTestClient creates a client accepting HMAC tokens with kid hmac
+// and RS256 and ES256 tokens with kid rsa and ec
+// the PEM block of the RSA key is returned to try signing HMAC tokens with it
+func newAuthTestClient(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) (*Client, []byte) {
+	pemBlock := func(kid string, key interface{}) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("Error marshaling public key: %s", err.Error())
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{"kid": kid}, Bytes: der})
+	}
+	rsaPEM := pemBlock("rsa", &rsaKey.PublicKey)
+	pemData := append(pemBlock("ec", &ecKey.PublicKey), rsaPEM...)
+
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys.pem")
+	err = ioutil.WriteFile(path, pemData, 0600)
+	if err != nil {
+		t.Fatalf("Error writing key file: %s", err.Error())
+	}
+	publicKeys, err := auth.LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("Error loading key file: %s", err.Error())
+	}
+
+	hmacKeys, err := auth.NewHMACKeySet(&auth.HMACKey{ID: "hmac", Secret: "secret"})
+	if err != nil {
+		t.Fatalf("Error creating HMAC keys: %s", err.Error())
+	}
+
+	handler := NewClientHandler(hmacKeys)
+	handler.PublicKeys = publicKeys
+	handler.TokenValidation = TokenValidation{Issuer: "auth", Audience: "realm", Leeway: 30 * time.Second}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return &Client{clientHandler: handler, Log: logrus.NewEntry(logger)}, rsaPEM
+}
+
+func TestParseAccessToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating RSA key: %s", err.Error())
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating EC key: %s", err.Error())
+	}
+	client, rsaPublicPEM := newAuthTestClient(t, rsaKey, ecKey)
+
+	now := time.Now().Unix()
+	leeway := int64(30)
+	valid := func() *auth.Claims {
+		return &auth.Claims{
+			StandardClaims: jwt.StandardClaims{Subject: "player", Issuer: "auth", IssuedAt: now, ExpiresAt: now + 60},
+			Audience:       auth.Audience{"realm"},
+		}
+	}
+	with := func(change func(claims *auth.Claims)) *auth.Claims {
+		claims := valid()
+		change(claims)
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		kid    string
+		claims *auth.Claims
+		err    string // message shown to the player, empty when the token is accepted
+	}{
+		{name: "HS256", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: valid()},
+		{name: "HS256 without kid uses the only HMAC key", method: jwt.SigningMethodHS256, key: []byte("secret"), claims: valid()},
+		{name: "RS256", method: jwt.SigningMethodRS256, key: rsaKey, kid: "rsa", claims: valid()},
+		{name: "ES256", method: jwt.SigningMethodES256, key: ecKey, kid: "ec", claims: valid()},
+
+		// signing methods
+		{name: "alg none", method: jwt.SigningMethodNone, key: jwt.UnsafeAllowNoneSignatureType, claims: valid(), err: "Error parsing token"},
+		{name: "alg outside the valid methods", method: jwt.SigningMethodRS512, key: rsaKey, kid: "rsa", claims: valid(), err: "Error parsing token"},
+		{name: "HS256 signed with the RSA public key", method: jwt.SigningMethodHS256, key: rsaPublicPEM, kid: "rsa", claims: valid(), err: "Error parsing token"},
+		{name: "HS256 signed with the RSA public key without kid", method: jwt.SigningMethodHS256, key: rsaPublicPEM, claims: valid(), err: "Error parsing token"},
+		{name: "ES256 with the kid of an RSA key", method: jwt.SigningMethodES256, key: ecKey, kid: "rsa", claims: valid(), err: "Error parsing token"},
+
+		// key ids
+		{name: "unknown HMAC kid", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "missing", claims: valid(), err: "Error parsing token"},
+		{name: "unknown public key kid", method: jwt.SigningMethodRS256, key: rsaKey, kid: "missing", claims: valid(), err: "Error parsing token"},
+		{name: "public key token without kid", method: jwt.SigningMethodRS256, key: rsaKey, claims: valid(), err: "Error parsing token"},
+		{name: "wrong HMAC secret", method: jwt.SigningMethodHS256, key: []byte("other"), kid: "hmac", claims: valid(), err: "Error parsing token"},
+
+		// leeway
+		{name: "expired within the leeway", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.ExpiresAt = now - leeway + 2 })},
+		{name: "expired past the leeway", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.ExpiresAt = now - leeway - 2 }), err: "Login session expired"},
+		{name: "no exp", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.ExpiresAt = 0 }), err: "Login session expired"},
+		{name: "nbf within the leeway", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.NotBefore = now + leeway - 2 })},
+		{name: "nbf past the leeway", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.NotBefore = now + leeway + 2 }), err: "Login session is not valid yet"},
+		{name: "iat within the leeway", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.IssuedAt = now + leeway - 2 })},
+		{name: "iat past the leeway", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.IssuedAt = now + leeway + 2 }), err: "Login session is not valid yet"},
+
+		// issuer and audience
+		{name: "wrong iss", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.Issuer = "other" }), err: "Token was not issued for this realm"},
+		{name: "no iss", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.Issuer = "" }), err: "Token was not issued for this realm"},
+		{name: "wrong aud", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.Audience = auth.Audience{"other"} }), err: "Token was not issued for this realm"},
+		{name: "no aud", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.Audience = nil }), err: "Token was not issued for this realm"},
+		{name: "aud array containing the realm", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.Audience = auth.Audience{"other", "realm"} })},
+		{name: "aud array without the realm", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.Audience = auth.Audience{"other", "another"} }), err: "Token was not issued for this realm"},
+
+		{name: "no username", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "hmac", claims: with(func(c *auth.Claims) { c.Subject = "" }), err: "Token has no username"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(test.method, test.claims)
+			if len(test.kid) > 0 {
+				token.Header["kid"] = test.kid
+			}
+			signed, err := token.SignedString(test.key)
+			if err != nil {
+				t.Fatalf("Error signing token: %s", err.Error())
+			}
+
+			claims, err := client.parseAccessToken(signed)
+			if len(test.err) == 0 {
+				if err != nil {
+					t.Fatalf("expected the token to be accepted, got %v", err)
+				}
+				if claims.Subject != "player" {
+					t.Fatalf("expected the username player, got %q", claims.Subject)
+				}
+				return
+			}
+
+			disconnectErr, ok := err.(*DisconnectError)
+			if !ok || disconnectErr.Message != test.err {
+				t.Fatalf("expected %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultAutosaveInterval is how often characters that changed are saved
+const DefaultAutosaveInterval = 5 * time.Minute
+
+// how often the autosave checks which characters are due
+const autosaveCheckInterval = time.Second
+
+// autosaveOffset is when a newly loaded character is first autosaved
+// a random point in the interval keeps characters that load together from saving together
+func autosaveOffset(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(interval)))
+}
+
+func (c *Character) markDirty() {
+	atomic.StoreInt32(&c.dirty, 1)
+}
+
+func (c *Character) isDirty() bool {
+	return atomic.LoadInt32(&c.dirty) == 1
+}
+
+// autosaveDue returns if the character should be saved now
+// the next autosave moves an interval ahead either way so a save that is still running isn't started again
+// characters without changes wait another interval
+func (c *Character) autosaveDue(now time.Time, interval time.Duration) bool {
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+
+	if c.location == nil || now.Before(c.nextAutosave) {
+		return false
+	}
+	c.nextAutosave = now.Add(interval)
+	return c.isDirty()
+}
+
+// autosave saves the characters in the realm that changed since their last save
+// each save runs on its own goroutine so a slow save doesn't delay the other characters
+func (handler *Handler) autosave() {
+	ticker := time.NewTicker(autosaveCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, client := range handler.connectedClients() {
+			if client.Disconnecting {
+				// disconnecting clients save their character themselves
+				continue
+			}
+
+			character := client.GetCharacter()
+			if character == nil || !character.autosaveDue(now, handler.AutosaveInterval) {
+				continue
+			}
+
+			go func() {
+				// Save logs the duration and any error
+				_ = character.Save()
+			}()
+		}
+	}
+}
@@ -20,6 +20,12 @@ func NewCamera(screenWidth, screenHeight int) *Camera {
 	}
 }
 
+func (camera *Camera) resize(screenWidth, screenHeight int, loc *location.Location) {
+	camera.screenWidth = screenWidth
+	camera.screenHeight = screenHeight
+	camera.update(loc)
+}
+
 func (camera *Camera) update(loc *location.Location) {
 	world := loc.GetWorld()
 	centerX := camera.screenWidth / 2
@@ -3,21 +3,30 @@ package client
 import (
 	"fmt"
 	"net/http"
-	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
-	"github.com/mitchellh/mapstructure"
-
 	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
 
 	"github.com/namelessmmo/realm/pkg/server/location"
+	"github.com/namelessmmo/realm/pkg/server/store"
 
 	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// MaxCharacters is the number of character slots of an account
+const MaxCharacters = 9
+
+// where new characters start
+const (
+	spawnWorld = "untitled"
+	spawnX     = 400
+	spawnY     = 400
+)
+
 type Movement struct {
 	Up    bool
 	Down  bool
@@ -36,8 +45,16 @@ type Character struct {
 
 	location *location.Location
 
-	lastSave time.Time
-	saveLock sync.Mutex
+	// summary of the saved character, the world is only used until the character is loaded
+	world      string
+	lastPlayed time.Time
+	level      int
+
+	lastSave     time.Time
+	nextAutosave time.Time
+	saveLock     sync.Mutex // guards the save summary and schedule, never held while saving
+	storeLock    sync.Mutex // saves of the character run one at a time so an older save can't overwrite a newer one
+	dirty        int32      // set when the character changed since the last save, accessed atomically
 
 	Log *logrus.Entry
 }
@@ -53,35 +70,128 @@ func NewCharacter(id int, name string, client *Client) *Character {
 	}
 }
 
+// newCharacterFromData creates a character that is not loaded yet from its saved summary
+func newCharacterFromData(data *store.CharacterData, client *Client) *Character {
+	character := NewCharacter(data.ID, data.Name, client)
+	character.world = data.World
+	character.lastPlayed = data.LastPlayed
+	character.level = data.Level
+	return character
+}
+
+func (c *Character) setClient(client *Client) {
+	c.client = client
+	c.Log = client.Log.WithField("character_id", c.ID).WithField("character_name", c.Name)
+}
+
+func (c *Character) isLoaded() bool {
+	return c.location != nil
+}
+
 func (c *Character) GetLocation() *location.Location {
 	return c.location
 }
 
 func (c *Character) SetLocation(location *location.Location) {
 	c.location = location
+	c.markDirty()
 	c.client.Camera.update(c.location)
 }
 
 func (c *Character) Load() error {
 	// only basic information of the character is loaded
 	// when a player selects the character load the rest
-	c.SetLocation(location.NewLocation(location.WorldHandler.GetWorld("untitled"), 400, 400))
+	data, err := c.client.clientHandler.Characters.LoadCharacter(c.client.Username, c.ID)
+	if err == store.ErrCharacterNotFound {
+		c.Log.Infof("New character, starting at the spawn")
+		data = &store.CharacterData{ID: c.ID, Name: c.Name, World: spawnWorld, X: spawnX, Y: spawnY}
+	} else if err != nil {
+		return errors.Wrap(err, "Error loading character")
+	}
 
+	world := location.WorldHandler.GetWorld(data.World)
+	if world == nil {
+		c.Log.WithField("world", data.World).Warnf("Character world does not exist, moving to the spawn")
+		world = location.WorldHandler.GetWorld(spawnWorld)
+		data.X, data.Y = spawnX, spawnY
+	}
+	c.SetLocation(location.NewLocation(world, data.X, data.Y))
+
+	c.saveLock.Lock()
+	atomic.StoreInt32(&c.dirty, 0)
 	c.lastSave = time.Now()
+	c.nextAutosave = c.lastSave.Add(autosaveOffset(c.client.clientHandler.AutosaveInterval))
+	c.saveLock.Unlock()
+
 	c.Log.Infof("Character loaded")
 	return nil
 }
 
 func (c *Character) Save() error {
-	c.saveLock.Lock()
-	defer c.saveLock.Unlock()
+	c.storeLock.Lock()
+	defer c.storeLock.Unlock()
+
+	loc := c.GetLocation()
+	if loc == nil {
+		// never loaded so there is nothing new to save
+		return nil
+	}
 
 	c.Log.Infof("Saving character")
 
-	// TODO: save character
+	// changes made while saving are saved next time
+	atomic.StoreInt32(&c.dirty, 0)
+
+	lastPlayed := time.Now()
+	c.saveLock.Lock()
+	data := &store.CharacterData{
+		ID:         c.ID,
+		Name:       c.Name,
+		World:      loc.GetWorld().Name,
+		X:          loc.GetX(),
+		Y:          loc.GetY(),
+		LastPlayed: lastPlayed,
+		Level:      c.level,
+	}
+	c.saveLock.Unlock()
+
+	start := time.Now()
+	err := c.client.clientHandler.Characters.SaveCharacter(c.client.Username, data)
+	duration := time.Since(start)
+	if err != nil {
+		c.markDirty()
+		c.Log.WithError(err).WithField("duration", duration).Errorf("Error saving character")
+		return errors.Wrap(err, "Error saving character")
+	}
+
+	c.saveLock.Lock()
+	c.lastSave = time.Now()
+	c.lastPlayed = lastPlayed
+	c.nextAutosave = c.lastSave.Add(c.client.clientHandler.AutosaveInterval)
+	c.saveLock.Unlock()
+
+	c.Log.WithField("duration", duration).Infof("Saved character")
 	return nil
 }
 
+// playerCharacter is the summary shown on character selection
+func (c *Character) playerCharacter() *outgoing.PlayerCharacter {
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+
+	world := c.world
+	if loc := c.GetLocation(); loc != nil {
+		world = loc.GetWorld().Name
+	}
+
+	var lastPlayed int64
+	if !c.lastPlayed.IsZero() {
+		lastPlayed = c.lastPlayed.Unix()
+	}
+
+	return &outgoing.PlayerCharacter{ID: c.ID, Name: c.Name, World: world, LastPlayed: lastPlayed, Level: c.level}
+}
+
 func (c *Character) Process() {
 	c.processMovement()
 }
@@ -141,8 +251,26 @@ type Client struct {
 	ScreenWidth  int
 	ScreenHeight int
 
-	Disconnected  bool
-	Disconnecting bool
+	capabilities map[string]bool
+
+	roles       map[Role]bool
+	permissions map[Permission]bool
+
+	snapshots   *snapshotTracker
+	rateLimiter *rateLimiter
+
+	phase Phase
+
+	Disconnected   bool
+	Disconnecting  bool
+	disconnected   chan struct{} // closed once Disconnected is set
+	disconnectOnce sync.Once
+
+	// resumeLock also guards setting Disconnecting so a client is only disconnected once
+	resumeLock  sync.Mutex
+	resumeToken string
+	detached    bool
+	detachedAt  time.Time
 
 	PacketHandler *PacketHandler
 	clientHandler *Handler
@@ -150,20 +278,34 @@ type Client struct {
 	Log *logrus.Entry
 }
 
-func NewClient(connection *websocket.Conn, id int, handler *Handler) *Client {
-	return &Client{
-		ID: id,
+func NewClient(connection *websocket.Conn, handler *Handler) *Client {
+	client := &Client{
+		ID: -1,
+
+		Characters: make([]*Character, MaxCharacters),
 
-		Characters: make([]*Character, 9),
+		phase: PhasePreLogin,
+
+		snapshots:   newSnapshotTracker(),
+		rateLimiter: newRateLimiter(handler.ClientRateLimit),
 
 		Disconnected:  false,
 		Disconnecting: false,
+		disconnected:  make(chan struct{}),
 
-		PacketHandler: NewPacketHandler(connection),
+		PacketHandler: NewPacketHandler(connection, handler.SendQueueConfig),
 		clientHandler: handler,
 
-		Log: logrus.WithField("client_id", id),
+		Log: logrus.WithField("remote_address", connection.RemoteAddr().String()),
+	}
+
+	client.PacketHandler.OnBacklog = func() {
+		dropped, coalesced := client.PacketHandler.SendQueueCounters()
+		client.Log.WithField("packets_dropped", dropped).WithField("packets_coalesced", coalesced).Warnf("Client is not keeping up with outgoing packets")
+		client.Disconnect(http.StatusServiceUnavailable, "Connection is too slow")
 	}
+
+	return client
 }
 
 func (c *Client) GetCharacter() *Character {
@@ -174,94 +316,142 @@ func (c *Client) SetCharacter(character *Character) {
 	c.Character = character
 }
 
+// GetLatency returns the smoothed round trip time measured with pings
+func (c *Client) GetLatency() Latency {
+	return c.PacketHandler.latency.get()
+}
+
+func (c *Client) playerInfo() *outgoing.PlayerInfo {
+	latency := c.GetLatency()
+	return &outgoing.PlayerInfo{
+		PlayerID: c.ID,
+		RTT:      int(latency.RTT / time.Millisecond),
+		Jitter:   int(latency.Jitter / time.Millisecond),
+	}
+}
+
+func (c *Client) GetPhase() Phase {
+	return c.phase
+}
+
+func (c *Client) SetPhase(phase Phase) {
+	c.Log.WithField("phase", phase).Debugf("Client changing phase")
+	c.phase = phase
+	c.PacketHandler.SetReadLimit(maxPacketSize(phase))
+}
+
 func (c *Client) Run() {
 	c.Log.Infof("Client starting")
 	c.PacketHandler.Setup()
 
 	rawPacket, err := c.PacketHandler.ReadRawPacket(5 * time.Second)
+	loginTime := time.Now()
 	if err != nil {
 		c.Log.Errorf("Error reading login info: %s", err.Error())
-		c.Disconnect(http.StatusRequestTimeout, "Did not receive login info")
+		if disconnectErr, ok := err.(*DisconnectError); ok {
+			c.Disconnect(disconnectErr.Code, disconnectErr.Message)
+		} else {
+			c.Disconnect(http.StatusRequestTimeout, "Did not receive login info")
+		}
 		return
 	}
 
 	c.Log.Infof("Client logging in")
 
-	playerLogin := &PlayerLogin{}
-	packetCode := reflect.TypeOf(playerLogin).Elem().Name()
-	if rawPacket.Code != packetCode {
-		c.Log.Errorf("Packet %s is not %s", rawPacket.Code, packetCode)
+	incomingPacket, err := decodeIncomingPacket(rawPacket, c.GetPhase())
+	if err != nil {
+		c.Log.WithError(err).Errorf("Error decoding login packet")
+		c.Disconnect(http.StatusBadRequest, "Received invalid login packet")
+		return
+	}
+
+	playerLogin, ok := incomingPacket.(*PlayerLogin)
+	if !ok {
+		c.Log.Errorf("Packet %s is not PlayerLogin", rawPacket.Code)
 		c.Disconnect(http.StatusMethodNotAllowed, "Received invalid login packet")
 		return
 	}
 
-	err = mapstructure.Decode(rawPacket.Data, playerLogin)
+	err = checkProtocolVersion(playerLogin.ProtocolVersion)
 	if err != nil {
-		c.Log.Errorf("Error decoding %s: %s", packetCode, err.Error())
-		c.Disconnect(http.StatusBadRequest, "Received invalid login packet")
+		disconnectErr := err.(*DisconnectError)
+		c.Log.WithField("protocol_version", playerLogin.ProtocolVersion).Errorf("Unsupported protocol version")
+		c.Disconnect(disconnectErr.Code, disconnectErr.Message)
 		return
 	}
+	c.setCapabilities(playerLogin.Capabilities)
+	c.PacketHandler.SetBatching(c.HasCapability(CapabilityBatch))
 
-	token, err := jwt.ParseWithClaims(playerLogin.AccessToken, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	if len(playerLogin.Codec) > 0 {
+		codec, ok := GetCodec(playerLogin.Codec)
+		if !ok {
+			c.Log.Warnf("Unknown codec %s, falling back to %s", playerLogin.Codec, codec.Name())
 		}
-
-		// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
-		return []byte(c.clientHandler.HMACString), nil
-	})
-	if err != nil {
-		c.Log.Errorf("Error parsing token %s", err.Error())
-		c.Disconnect(http.StatusUnauthorized, "Error parsing token")
-		return
+		c.PacketHandler.SetCodec(codec)
 	}
 
-	claims := token.Claims.(*jwt.StandardClaims)
+	c.PacketHandler.WritePacket(&outgoing.ProtocolInfo{Version: ProtocolVersion, Capabilities: Capabilities})
 
-	if claims.VerifyExpiresAt(time.Now().Unix(), true) == false {
-		c.Disconnect(http.StatusUnauthorized, "Login session expired")
+	claims, err := c.authenticate(playerLogin)
+	if err != nil {
+		disconnectErr := err.(*DisconnectError)
+		c.Disconnect(disconnectErr.Code, disconnectErr.Message)
 		return
 	}
 
-	if claims.VerifyIssuer("my-issuer", true) == false {
-		// TODO: return if token is not issued by us
+	if c.clientHandler.Bans != nil {
+		ban, err := c.clientHandler.Bans.FindBan(claims.Subject, claims.Id)
+		if err != nil {
+			c.Log.Errorf("Error checking bans: %s", err.Error())
+			c.Disconnect(http.StatusServiceUnavailable, "Unable to log in right now, please try again later")
+			return
+		}
+		if ban != nil {
+			c.Log.WithField("client_username", claims.Subject).Infof("Banned player tried to log in")
+			c.Disconnect(http.StatusForbidden, ban.Message())
+			return
+		}
 	}
 
 	c.Username = claims.Subject
 	c.Log = c.Log.WithField("client_username", c.Username)
-	if c.clientHandler.GetClientByUsername(c.Username).ID != c.ID {
-		c.Log.Errorf("player is already logged in")
-		c.Disconnect(http.StatusConflict, "Already logged into this realm, please wait 60 seconds and try again")
-		return
+	c.setRoles(claims.Roles)
+	resumed := false
+	if existing := c.clientHandler.getOtherClientByUsername(c.Username, c); existing != nil {
+		resumed = len(playerLogin.ResumeToken) > 0 && existing.resume(c, playerLogin.ResumeToken)
+		if !resumed && c.clientHandler.DuplicateLoginPolicy == DuplicateLoginTakeOver {
+			err = c.takeOver(existing)
+			if err != nil {
+				c.Log.WithError(err).Errorf("Error taking over existing session")
+				c.Disconnect(http.StatusConflict, "Already logged into this realm, please wait 60 seconds and try again")
+				return
+			}
+		} else if !resumed {
+			c.Log.Errorf("player is already logged in")
+			c.Disconnect(http.StatusConflict, "Already logged into this realm, please wait 60 seconds and try again")
+			return
+		}
 	}
-	c.Log.Infof("Client logged in")
+	c.Log.WithField("roles", c.Roles()).Infof("Client logged in")
+	c.startCapture(rawPacket, loginTime)
 
 	c.ScreenWidth = playerLogin.Screen.Width
 	c.ScreenHeight = playerLogin.Screen.Height
-	c.Camera = NewCamera(c.ScreenWidth, c.ScreenHeight)
-	c.PacketHandler.WritePacket(&outgoing.PlayerInfo{PlayerID: c.ID})
-
-	// TODO: load player characters (only basic info)
-	c.Log.Infof("Loading characters")
-	c.Characters[0] = NewCharacter(0, "char-name", c)
-
-	playerCharacters := &outgoing.PlayerCharacters{
-		Characters: make([]*outgoing.PlayerCharacter, 0),
-	}
-
-	for _, character := range c.Characters {
-		var playerCharacter *outgoing.PlayerCharacter
-		if character != nil {
-			playerCharacter = &outgoing.PlayerCharacter{ID: character.ID, Name: character.Name}
+	if resumed {
+		c.enterRealm(true)
+	} else if c.ID >= 0 {
+		// took over the slot of the existing session
+		c.enterRealm(false)
+	} else {
+		err = c.clientHandler.admit(c)
+		if err != nil {
+			disconnectErr := err.(*DisconnectError)
+			c.Log.Warnf("Realm and login queue are full")
+			c.Disconnect(disconnectErr.Code, disconnectErr.Message)
+			return
 		}
-		playerCharacters.Characters = append(playerCharacters.Characters, playerCharacter)
 	}
 
-	c.PacketHandler.WritePacket(playerCharacters)
-
-	c.Log.Infof("Client ready to select character")
-
 	// do we need to send/receive anything else?
 
 	// client is doing whatever loading things it needs
@@ -271,43 +461,163 @@ func (c *Client) Run() {
 	// This is probably bad so we should figure out a better way
 	// currently each client has it's own goroutine, don't really know of a better way currently
 	for {
-		if c.Disconnecting { // if the client disconnected stop processing incoming packets
+		if c.Disconnecting || c.isDetached() { // if the client disconnected stop processing incoming packets
 			break
 		}
 
 		err := c.PacketHandler.processIncomingPackets(c)
 		if err != nil {
 			c.Log.WithError(err).Errorf("Error processing packets, disconnecting")
-			c.Disconnect(http.StatusBadRequest, "Invalid packet sent by client")
+			if disconnectErr, ok := errors.Cause(err).(*DisconnectError); ok {
+				c.Disconnect(disconnectErr.Code, disconnectErr.Message)
+			} else {
+				c.Disconnect(http.StatusBadRequest, "Invalid packet sent by client")
+			}
 			break
 		}
 	}
+
+	c.rateLimiter.logCounters(c)
+}
+
+// enterRealm sends the player their characters once the client has a slot in the realm
+// a resumed session goes straight back into the game
+func (c *Client) enterRealm(resumed bool) {
+	if resumed {
+		c.Camera.resize(c.ScreenWidth, c.ScreenHeight, c.Character.GetLocation())
+	} else {
+		c.Camera = NewCamera(c.ScreenWidth, c.ScreenHeight)
+	}
+	c.PacketHandler.WritePacket(c.playerInfo())
+
+	if !resumed {
+		c.Log.Infof("Loading characters")
+		err := c.loadCharacters()
+		if err != nil {
+			c.Log.WithError(err).Errorf("Error loading characters")
+			c.Disconnect(http.StatusServiceUnavailable, "Error loading characters, please try again later")
+			return
+		}
+	}
+
+	playerCharacters := &outgoing.PlayerCharacters{
+		Characters: make([]*outgoing.PlayerCharacter, 0),
+	}
+
+	for _, character := range c.Characters {
+		var playerCharacter *outgoing.PlayerCharacter
+		if character != nil {
+			playerCharacter = character.playerCharacter()
+		}
+		playerCharacters.Characters = append(playerCharacters.Characters, playerCharacter)
+	}
+
+	c.PacketHandler.WritePacket(playerCharacters)
+
+	c.SetPhase(PhaseCharacterSelect)
+	if resumed {
+		// skip character selection and go straight back into the game
+		c.PacketHandler.WritePacket(&outgoing.CharacterLoading{CharacterID: c.CharacterToLoad.ID})
+		c.Log.Infof("Client resumed session")
+	} else {
+		c.Log.Infof("Client ready to select character")
+	}
+}
+
+// loadCharacters puts the saved characters of the account into their slots, the slot is the character id
+// accounts without characters get a starter character until characters can be created
+func (c *Client) loadCharacters() error {
+	characters, err := c.clientHandler.Characters.ListCharacters(c.Username)
+	if err != nil {
+		return err
+	}
+
+	if len(characters) == 0 {
+		characters = append(characters, &store.CharacterData{ID: 0, Name: c.Username, World: spawnWorld})
+	}
+
+	for _, data := range characters {
+		if data.ID < 0 || data.ID >= len(c.Characters) {
+			c.Log.WithField("character_id", data.ID).Warnf("Saved character is not in a character slot")
+			continue
+		}
+		c.Characters[data.ID] = newCharacterFromData(data, c)
+	}
+	return nil
+}
+
+// startCapture records the packets of the client if the player was chosen to be captured
+func (c *Client) startCapture(loginPacket *RawIncomingPacket, loginTime time.Time) {
+	if c.clientHandler.CaptureUsernames[c.Username] == false {
+		return
+	}
+
+	recorder, err := NewPacketRecorder(c.clientHandler.CaptureDir, c.Username)
+	if err != nil {
+		c.Log.WithError(err).Errorf("Error starting packet capture")
+		return
+	}
+
+	err = recorder.Record(loginTime, CaptureIncoming, loginPacket.Code, redactLogin(loginPacket.Data))
+	if err != nil {
+		c.Log.WithError(err).Errorf("Error capturing login packet")
+	}
+
+	c.PacketHandler.SetRecorder(recorder)
+	c.Log.WithField("capture_file", recorder.Name()).Infof("Capturing client packets")
+}
+
+// DisconnectError is returned when the client should be disconnected with a specific reason
+type DisconnectError struct {
+	Code    int
+	Message string
+}
+
+func (err *DisconnectError) Error() string {
+	return fmt.Sprintf("disconnect %d: %s", err.Code, err.Message)
 }
 
 func (c *Client) Disconnect(code int, message string) {
-	if c.Disconnecting {
+	// the reader, the writer and other clients can all disconnect the client, only the first one does
+	c.resumeLock.Lock()
+	if c.Disconnecting || c.detached {
+		c.resumeLock.Unlock()
 		return
 	}
-	c.Log.WithField("disconnect_code", code).WithField("diconnect_message", message).Info("Disconnecting client")
+
+	if code == StatusClientClosedRequest && c.canResume() {
+		c.detach()
+		c.resumeLock.Unlock()
+		return
+	}
+
 	c.Disconnecting = true
+	c.resumeLock.Unlock()
+
+	c.Log.WithField("disconnect_code", code).WithField("diconnect_message", message).Info("Disconnecting client")
 
 	if c.Character != nil {
 		go func() {
 			// don't worry about waiting for combat to finish or whatever
 			// it's too annoying to deal with
-			err := c.Character.Save()
-			if err != nil {
-				c.Log.Errorf("Error saving player during a disconnect")
-			}
-			c.Disconnected = true
+			// Save logs the duration and any error
+			_ = c.Character.Save()
+			c.setDisconnected()
 		}()
 	} else {
-		c.Disconnected = true
+		c.setDisconnected()
 	}
 
 	c.PacketHandler.WritePacket(&outgoing.PlayerDisconnect{Code: code, Message: message})
 }
 
+func (c *Client) setDisconnected() {
+	c.disconnectOnce.Do(func() {
+		c.Disconnected = true
+		close(c.disconnected)
+	})
+}
+
 func (c *Client) Process() {
 	if c.Character != nil {
 		c.Character.Process()
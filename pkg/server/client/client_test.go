@@ -0,0 +1,46 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestDisconnectFromSeveralGoroutines(t *testing.T) {
+	client := newQueueTestClient("player")
+	client.disconnected = make(chan struct{})
+
+	start := make(chan struct{})
+	wait := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			<-start
+			client.Disconnect(http.StatusServiceUnavailable, "Connection is too slow")
+		}()
+	}
+	close(start)
+	wait.Wait()
+
+	select {
+	case <-client.disconnected:
+	default:
+		t.Fatalf("expected the client to be disconnected")
+	}
+
+	// only the first disconnect tells the player why
+	disconnects := 0
+	for {
+		packet, _ := client.PacketHandler.sendQueue.pop()
+		if packet == nil {
+			break
+		}
+		if packet.code == "PlayerDisconnect" {
+			disconnects++
+		}
+	}
+	if disconnects != 1 {
+		t.Fatalf("expected 1 PlayerDisconnect, got %d", disconnects)
+	}
+}
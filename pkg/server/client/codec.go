@@ -0,0 +1,123 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/ugorji/go/codec"
+)
+
+const (
+	JSONCodecName    = "json"
+	MsgpackCodecName = "msgpack"
+)
+
+// Codec encodes and decodes packets sent over the websocket
+type Codec interface {
+	Name() string
+
+	// MessageType is the websocket message type the codec writes
+	MessageType() int
+
+	Encode(packet *RawOutgoingPacket) ([]byte, error)
+	EncodeBatch(packets []*RawOutgoingPacket) ([]byte, error)
+	Decode(message []byte, packet *RawIncomingPacket) error
+}
+
+var codecs = map[string]Codec{
+	JSONCodecName:    &jsonCodec{},
+	MsgpackCodecName: newMsgpackCodec(),
+}
+
+// GetCodec returns the codec with the given name
+// JSON is returned if the name is unknown
+func GetCodec(name string) (Codec, bool) {
+	c, ok := codecs[name]
+	if !ok {
+		return codecs[JSONCodecName], false
+	}
+	return c, true
+}
+
+// codecForMessageType returns the codec used to decode a message of the websocket message type
+func codecForMessageType(messageType int) Codec {
+	if messageType == websocket.BinaryMessage {
+		return codecs[MsgpackCodecName]
+	}
+	return codecs[JSONCodecName]
+}
+
+// jsonCodec is the default codec, it is also the easiest to debug
+type jsonCodec struct{}
+
+func (*jsonCodec) Name() string {
+	return JSONCodecName
+}
+
+func (*jsonCodec) MessageType() int {
+	return websocket.TextMessage
+}
+
+func (*jsonCodec) Encode(packet *RawOutgoingPacket) ([]byte, error) {
+	return json.Marshal(packet)
+}
+
+func (*jsonCodec) EncodeBatch(packets []*RawOutgoingPacket) ([]byte, error) {
+	return json.Marshal(packets)
+}
+
+func (*jsonCodec) Decode(message []byte, packet *RawIncomingPacket) error {
+	return json.Unmarshal(message, packet)
+}
+
+// msgpackCodec is a compact binary codec
+// struct fields use the same names as their json tags
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgpackCodec() *msgpackCodec {
+	handle := &codec.MsgpackHandle{
+		RawToString: true,
+		WriteExt:    true,
+	}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+
+	return &msgpackCodec{handle: handle}
+}
+
+func (*msgpackCodec) Name() string {
+	return MsgpackCodecName
+}
+
+func (*msgpackCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (c *msgpackCodec) Encode(packet *RawOutgoingPacket) ([]byte, error) {
+	var message []byte
+	err := codec.NewEncoderBytes(&message, c.handle).Encode(packet)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error encoding msgpack")
+	}
+	return message, nil
+}
+
+func (c *msgpackCodec) EncodeBatch(packets []*RawOutgoingPacket) ([]byte, error) {
+	var message []byte
+	err := codec.NewEncoderBytes(&message, c.handle).Encode(packets)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error encoding msgpack")
+	}
+	return message, nil
+}
+
+func (c *msgpackCodec) Decode(message []byte, packet *RawIncomingPacket) error {
+	err := codec.NewDecoderBytes(message, c.handle).Decode(packet)
+	if err != nil {
+		return errors.Wrap(err, "Error decoding msgpack")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DuplicateLoginPolicy decides what happens when a player logs in while they are already connected
+type DuplicateLoginPolicy int
+
+const (
+	// DuplicateLoginReject disconnects the new login
+	DuplicateLoginReject DuplicateLoginPolicy = iota
+
+	// DuplicateLoginTakeOver disconnects the existing client and lets the new login take its place
+	DuplicateLoginTakeOver
+)
+
+// how long the existing client has to save its character when it is taken over
+var takeOverTimeout = 10 * time.Second
+
+func (policy DuplicateLoginPolicy) String() string {
+	switch policy {
+	case DuplicateLoginReject:
+		return "reject"
+	case DuplicateLoginTakeOver:
+		return "take-over"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseDuplicateLoginPolicy returns the policy with the name
+func ParseDuplicateLoginPolicy(name string) (DuplicateLoginPolicy, error) {
+	for _, policy := range []DuplicateLoginPolicy{DuplicateLoginReject, DuplicateLoginTakeOver} {
+		if policy.String() == name {
+			return policy, nil
+		}
+	}
+	return DuplicateLoginReject, errors.Errorf("Unknown duplicate login policy %s", name)
+}
+
+// takeOverReservation keeps the slot of a client that is being taken over for the client taking over
+type takeOverReservation struct {
+	client *Client
+	done   chan struct{} // closed once the existing client was removed
+}
+
+// takeOver disconnects the existing client of the player and waits for its character to be saved
+// the client gets the slot of the existing client so it doesn't have to queue
+func (c *Client) takeOver(existing *Client) error {
+	reservation, err := c.clientHandler.reserveTakeOver(existing, c)
+	if err != nil {
+		return err
+	}
+	if reservation == nil {
+		// the existing client left while logging in
+		return nil
+	}
+
+	existing.Log.Infof("Player logged in from another location")
+	existing.kick(http.StatusConflict, "Logged in from another location")
+
+	select {
+	case <-reservation.done:
+	case <-time.After(takeOverTimeout):
+		if c.clientHandler.cancelTakeOver(existing, reservation) {
+			return errors.New("Timed out waiting for the existing client to disconnect")
+		}
+		// the existing client was removed while cancelling
+	}
+
+	c.Log.Infof("Client took over the existing session")
+	return nil
+}
+
+// reserveTakeOver makes removeClient hand the slot of the existing client to the client
+// the reservation is nil when the existing client is already gone
+func (handler *Handler) reserveTakeOver(existing *Client, client *Client) (*takeOverReservation, error) {
+	handler.clientsLock.Lock()
+	defer handler.clientsLock.Unlock()
+
+	if _, ok := handler.takeOvers[existing]; ok {
+		return nil, errors.New("The existing client is already being taken over")
+	}
+
+	connected := existing.ID >= 0 && handler.clients[existing.ID] == existing
+	for _, queued := range handler.queue {
+		connected = connected || queued == existing
+	}
+	if !connected {
+		return nil, nil
+	}
+
+	reservation := &takeOverReservation{client: client, done: make(chan struct{})}
+	handler.takeOvers[existing] = reservation
+	return reservation, nil
+}
+
+// cancelTakeOver gives up the reservation so the slot is freed normally once the existing client is removed
+// returns false when the existing client was already removed and the slot handed over
+func (handler *Handler) cancelTakeOver(existing *Client, reservation *takeOverReservation) bool {
+	handler.clientsLock.Lock()
+	defer handler.clientsLock.Unlock()
+
+	if handler.takeOvers[existing] != reservation {
+		return false
+	}
+	delete(handler.takeOvers, existing)
+	return true
+}
+
+// kick disconnects the client even if its connection was lost and it is waiting to be resumed
+func (c *Client) kick(code int, message string) {
+	c.resumeLock.Lock()
+	c.detached = false
+	c.resumeToken = ""
+	c.resumeLock.Unlock()
+
+	c.Disconnect(code, message)
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+// startTakeOver takes over the existing client on another goroutine, the error is sent once it is done
+func startTakeOver(client *Client, existing *Client) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- client.takeOver(existing)
+	}()
+	return result
+}
+
+func TestTakeOverGetsSlot(t *testing.T) {
+	handler := newFullHandler(DefaultLoginQueueSize)
+	existing := newSlotTestClient(handler, "player", 3)
+
+	client := newQueueTestClient("player")
+	client.clientHandler = handler
+	result := startTakeOver(client, existing)
+
+	// the take over waits until the existing client was removed
+	<-existing.disconnected
+	select {
+	case err := <-result:
+		t.Fatalf("expected the take over to wait for the existing client to be removed, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if handler.clients[3] != existing {
+		t.Fatalf("expected the existing client to keep slot 3 until it is removed")
+	}
+
+	handler.removeClient(existing)
+	if err := <-result; err != nil {
+		t.Fatalf("Error taking over: %s", err.Error())
+	}
+	if client.ID != 3 || handler.clients[3] != client {
+		t.Fatalf("expected the client to get slot 3, got id %d", client.ID)
+	}
+	if _, ok := handler.takeOvers[existing]; ok {
+		t.Fatalf("expected the reservation to be removed")
+	}
+}
+
+func TestTakeOverTimeout(t *testing.T) {
+	timeout := takeOverTimeout
+	takeOverTimeout = 50 * time.Millisecond
+	defer func() { takeOverTimeout = timeout }()
+
+	handler := newFullHandler(DefaultLoginQueueSize)
+	existing := newSlotTestClient(handler, "player", 3)
+
+	client := newQueueTestClient("player")
+	client.clientHandler = handler
+	if err := <-startTakeOver(client, existing); err == nil {
+		t.Fatalf("expected the take over to time out")
+	}
+
+	// the existing client is removed after the timeout and frees its slot normally
+	handler.removeClient(existing)
+	if client.ID != -1 || handler.clients[3] != nil {
+		t.Fatalf("expected slot 3 to be freed, got client id %d and slot %v", client.ID, handler.clients[3])
+	}
+}
+
+func TestTakeOverQueued(t *testing.T) {
+	handler := newFullHandler(DefaultLoginQueueSize)
+	existing := newQueueTestClient("player")
+	existing.clientHandler = handler
+	existing.disconnected = make(chan struct{})
+	if err := handler.admit(existing); err != nil {
+		t.Fatalf("Error admitting player: %s", err.Error())
+	}
+
+	client := newQueueTestClient("player")
+	client.clientHandler = handler
+	result := startTakeOver(client, existing)
+
+	<-existing.disconnected
+	handler.removeClient(existing)
+	if err := <-result; err != nil {
+		t.Fatalf("Error taking over: %s", err.Error())
+	}
+
+	// a queued client has no slot to hand over so the client goes back through admit
+	if client.ID != -1 || len(handler.queue) != 0 {
+		t.Fatalf("expected the client to have no slot and the queue to be empty, got id %d and queue %v", client.ID, queuedUsernames(handler))
+	}
+	if err := handler.admit(client); err != nil {
+		t.Fatalf("Error admitting player: %s", err.Error())
+	}
+	if len(handler.queue) != 1 || handler.queue[0] != client {
+		t.Fatalf("expected the client to be queued, got %v", queuedUsernames(handler))
+	}
+}
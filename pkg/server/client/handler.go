@@ -2,12 +2,13 @@ package client
 
 import (
 	"net/http"
-	"runtime"
 	"sync"
 	"time"
 
+	"github.com/namelessmmo/realm/pkg/server/auth"
 	"github.com/namelessmmo/realm/pkg/server/location"
 	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+	"github.com/namelessmmo/realm/pkg/server/store"
 	"github.com/pkg/errors"
 
 	"github.com/gorilla/websocket"
@@ -17,17 +18,71 @@ const MaxClients = 100
 
 const tickRate = (1000 / 60) * time.Millisecond // half of a frame at 60 frames
 
+// default limit for all packets sent by a single client that were not dropped by their packet limit
+// well above what a client moving and acknowledging every state sends so only floods are disconnected
+var defaultClientRateLimit = RateLimit{Rate: 300, Burst: 100, Policy: RateLimitDisconnect}
+
 type Handler struct {
-	HMACString string
+	// HMACKeys verify HMAC access tokens, nil only accepts public key tokens
+	HMACKeys *auth.HMACKeySet
+
+	// PublicKeys verify RS256 and ES256 access tokens, nil only accepts HMAC tokens
+	PublicKeys *auth.KeySet
+
+	// DevLogin lets players log in with only a username, never enable this on a public realm
+	DevLogin bool
+
+	// TokenValidation are the claims required in access tokens
+	TokenValidation TokenValidation
+
+	// Bans are checked when players log in, nil disables bans
+	Bans auth.BanStore
+
+	// Characters saves the characters of every account
+	Characters store.CharacterStore
+
+	// AutosaveInterval is how often characters that changed are saved, 0 disables autosaving
+	AutosaveInterval time.Duration
+
+	// ClientRateLimit limits all packets sent by a client
+	ClientRateLimit RateLimit
+
+	SendQueueConfig SendQueueConfig
+
+	// CaptureDir is where packet captures are written
+	// CaptureUsernames are the players whose packets are captured
+	CaptureDir       string
+	CaptureUsernames map[string]bool
+
+	// DuplicateLoginPolicy decides what happens when a player logs in twice
+	DuplicateLoginPolicy DuplicateLoginPolicy
+
+	// LoginQueueSize is how many logged in players can wait for a free slot
+	// 0 disconnects players when the realm is full
+	LoginQueueSize int
+
+	// ResumeGracePeriod is how long a character stays in the world after the connection was lost
+	// 0 disables resuming sessions
+	ResumeGracePeriod time.Duration
 
 	clientsLock sync.Mutex
 	clients     []*Client
+	queue       []*Client // logged in clients waiting for a slot
+	connections int       // open connections, including clients that are not logged in yet
+	takeOvers   map[*Client]*takeOverReservation
 }
 
-func NewClientHandler(hmacString string) *Handler {
+func NewClientHandler(hmacKeys *auth.HMACKeySet) *Handler {
 	return &Handler{
-		HMACString: hmacString,
-		clients:    make([]*Client, MaxClients),
+		HMACKeys:          hmacKeys,
+		TokenValidation:   TokenValidation{Leeway: DefaultTokenLeeway},
+		ClientRateLimit:   defaultClientRateLimit,
+		SendQueueConfig:   DefaultSendQueueConfig,
+		AutosaveInterval:  DefaultAutosaveInterval,
+		LoginQueueSize:    DefaultLoginQueueSize,
+		ResumeGracePeriod: DefaultResumeGracePeriod,
+		clients:           make([]*Client, MaxClients),
+		takeOvers:         make(map[*Client]*takeOverReservation),
 	}
 }
 
@@ -43,51 +98,107 @@ func (handler *Handler) GetClientByUsername(username string) *Client {
 	return nil
 }
 
-func (handler *Handler) addClient(conn *websocket.Conn) {
-	// Lock the clients
+// getOtherClientByUsername finds a logged in or queued client with the username that is not the client
+func (handler *Handler) getOtherClientByUsername(username string, other *Client) *Client {
 	handler.clientsLock.Lock()
 	defer handler.clientsLock.Unlock()
 
-	// Get the new client ID
-	id := -1
-
-	for i, c := range handler.clients {
-		if c == nil {
-			id = i
-			break
+	for _, clients := range [][]*Client{handler.clients, handler.queue} {
+		for _, client := range clients {
+			if client == nil || client == other {
+				continue
+			}
+			if client.Username == username {
+				return client
+			}
 		}
 	}
+	return nil
+}
+
+func (handler *Handler) addClient(conn *websocket.Conn) {
+	// Lock the clients
+	handler.clientsLock.Lock()
+	defer handler.clientsLock.Unlock()
 
-	if id == -1 {
-		// Close the connection because we are full
+	if handler.connections >= MaxClients+handler.LoginQueueSize {
+		// Close the connection because we are full and so is the queue
 		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, ""))
 		_ = conn.Close()
 		return
 	}
+	handler.connections++
 
-	// Create the client
-	client := NewClient(conn, id, handler)
+	// Create the client, it gets an ID once it is logged in and has a slot
+	client := NewClient(conn, handler)
 
 	closeHandler := conn.CloseHandler() // get the existing close handler
 	conn.SetCloseHandler(func(code int, text string) error {
-		client.Disconnect(499, "Client disconnected")
+		client.Disconnect(StatusClientClosedRequest, "Client disconnected")
 		return closeHandler(code, text) // call the existing close handler
 	})
 
-	// Set the client
-	handler.clients[id] = client
-
 	// Start the client
 	go client.Run()
 
+	// Start writing packets to the client
+	go func() {
+		client.PacketHandler.writePackets()
+
+		// the connection is closed, wait for the client to finish disconnecting
+		<-client.disconnected
+		handler.removeClient(client)
+	}()
+
 }
 
-func (handler *Handler) removeClient(id int) {
+func (handler *Handler) removeClient(client *Client) {
 	// Lock the clients
 	handler.clientsLock.Lock()
+
+	handler.connections--
+	reservation, takenOver := handler.takeOvers[client]
+	if client.ID >= 0 && handler.clients[client.ID] == client {
+		if takenOver {
+			handler.assignSlot(reservation.client, client.ID)
+		} else {
+			handler.clients[client.ID] = nil
+		}
+	}
+	if takenOver {
+		delete(handler.takeOvers, client)
+		close(reservation.done)
+	}
+	handler.removeQueued(client)
+
+	admitted := handler.admitQueued()
+	handler.clientsLock.Unlock()
+
+	for _, queued := range admitted {
+		go queued.enterRealm(false)
+	}
+}
+
+// connectedClients returns the clients that have a slot in the realm
+func (handler *Handler) connectedClients() []*Client {
+	handler.clientsLock.Lock()
+	defer handler.clientsLock.Unlock()
+
+	clients := make([]*Client, 0, len(handler.clients))
+	for _, client := range handler.clients {
+		if client != nil {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// replaceClient gives the slot of the old client to the new client
+func (handler *Handler) replaceClient(old *Client, client *Client) {
+	handler.clientsLock.Lock()
 	defer handler.clientsLock.Unlock()
 
-	handler.clients[id] = nil
+	handler.assignSlot(client, old.ID)
 }
 
 func (handler *Handler) HandleClient(w http.ResponseWriter, r *http.Request, upgrader websocket.Upgrader) error {
@@ -112,6 +223,7 @@ func (handler *Handler) process() {
 				continue
 			}
 
+			client.expireDetached()
 			client.Process()
 
 		}
@@ -120,29 +232,6 @@ func (handler *Handler) process() {
 	}
 }
 
-func (handler *Handler) packets() {
-	for {
-		// Process outgoing packets for clients
-
-		// Process outgoing packets as fast as we can
-		// things will only write if there is stuff in the buffer
-		// or a ping
-		for _, client := range handler.clients {
-			if client == nil {
-				continue
-			}
-
-			if client.PacketHandler.ProcessOutgoingPackets() == false && client.Disconnected == true {
-				handler.removeClient(client.ID)
-			}
-		}
-
-		// This is considered a "tight loop" when there is nothing to process
-		// https://github.com/golang/go/issues/29493
-		runtime.Gosched()
-	}
-}
-
 func (handler *Handler) state() {
 	for {
 		// send state updates to clients
@@ -150,16 +239,17 @@ func (handler *Handler) state() {
 			if myClient == nil {
 				continue
 			}
-			if myClient.Disconnecting == true {
+			if myClient.Disconnecting == true || myClient.isDetached() {
+				continue
+			}
+			if myClient.GetPhase() != PhaseInGame {
 				continue
 			}
 			myCharacter := myClient.GetCharacter()
 			if myCharacter == nil {
 				continue
 			}
-			statePacket := &outgoing.LocalCharacterState{
-				Characters: make([]outgoing.CharacterState, 0),
-			}
+			characterStates := make([]outgoing.CharacterState, 0)
 
 			myCamera := myClient.Camera
 			loc := myCamera.Location
@@ -189,10 +279,14 @@ func (handler *Handler) state() {
 				if clientLoc.GetX() > bottomRight.GetX() || clientLoc.GetY() > bottomRight.GetY() {
 					continue
 				}
-				statePacket.Characters = append(statePacket.Characters, outgoing.CharacterState{ID: character.ID, PlayerID: client.ID, Location: outgoing.CharacterStateLocation{World: clientLoc.GetWorld().Name, X: clientLoc.GetX(), Y: clientLoc.GetY()}})
+				characterStates = append(characterStates, outgoing.CharacterState{ID: character.ID, PlayerID: client.ID, Location: outgoing.CharacterStateLocation{World: clientLoc.GetWorld().Name, X: clientLoc.GetX(), Y: clientLoc.GetY()}})
 			}
 
-			myClient.PacketHandler.WritePacket(statePacket)
+			// only send what changed since the last snapshot the client acknowledged
+			statePacket := myClient.snapshots.next(characterStates, myClient.HasCapability(CapabilityDeltaState))
+			if statePacket != nil {
+				myClient.PacketHandler.WritePacket(statePacket)
+			}
 		}
 
 		// send a state update every frame
@@ -204,6 +298,8 @@ func (handler *Handler) state() {
 
 func (handler *Handler) Run() {
 	go handler.process()
-	go handler.packets()
 	go handler.state()
+	if handler.AutosaveInterval > 0 {
+		go handler.autosave()
+	}
 }
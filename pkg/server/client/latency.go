@@ -0,0 +1,81 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// how many pings are remembered while waiting for their pong
+const maxOutstandingPings = 8
+
+// Latency is the smoothed round trip time of a client
+type Latency struct {
+	RTT     time.Duration
+	Jitter  time.Duration
+	Samples int
+}
+
+// latencyTracker estimates the round trip time and jitter from ping/pong samples
+// the estimate is calculated the same way as TCP (RFC 6298)
+type latencyTracker struct {
+	lock sync.Mutex
+
+	nextPingID int
+	pings      map[int]time.Time
+
+	latency Latency
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		pings: make(map[int]time.Time),
+	}
+}
+
+// ping records a ping being sent and returns its id
+func (tracker *latencyTracker) ping(now time.Time) int {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.nextPingID++
+	tracker.pings[tracker.nextPingID] = now
+	delete(tracker.pings, tracker.nextPingID-maxOutstandingPings)
+
+	return tracker.nextPingID
+}
+
+// pong records the answer to a ping
+// false is returned if the ping is unknown
+func (tracker *latencyTracker) pong(id int, now time.Time) bool {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	sent, ok := tracker.pings[id]
+	if !ok {
+		return false
+	}
+	delete(tracker.pings, id)
+
+	rtt := now.Sub(sent)
+	if tracker.latency.Samples == 0 {
+		tracker.latency.RTT = rtt
+		tracker.latency.Jitter = rtt / 2
+	} else {
+		diff := tracker.latency.RTT - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		tracker.latency.Jitter = (3*tracker.latency.Jitter + diff) / 4
+		tracker.latency.RTT = (7*tracker.latency.RTT + rtt) / 8
+	}
+	tracker.latency.Samples++
+
+	return true
+}
+
+func (tracker *latencyTracker) get() Latency {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	return tracker.latency
+}
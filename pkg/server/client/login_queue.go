@@ -0,0 +1,114 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+)
+
+// DefaultLoginQueueSize is how many players can wait for a free slot when the realm is full
+const DefaultLoginQueueSize = 500
+
+// admit gives the logged in client a slot in the realm
+// the client is queued when the realm is full and enters the realm once a slot frees up
+func (handler *Handler) admit(client *Client) error {
+	handler.clientsLock.Lock()
+
+	if id := handler.freeSlot(); id >= 0 {
+		handler.assignSlot(client, id)
+		handler.clientsLock.Unlock()
+
+		client.enterRealm(false)
+		return nil
+	}
+	defer handler.clientsLock.Unlock()
+
+	if len(handler.queue) >= handler.LoginQueueSize {
+		return &DisconnectError{Code: http.StatusServiceUnavailable, Message: "The realm is full, please try again later"}
+	}
+
+	// privileged players skip everybody without priority but stay behind each other
+	position := len(handler.queue)
+	if client.HasPermission(PermissionQueuePriority) {
+		position = 0
+		for position < len(handler.queue) && handler.queue[position].HasPermission(PermissionQueuePriority) {
+			position++
+		}
+	}
+
+	handler.queue = append(handler.queue, nil)
+	copy(handler.queue[position+1:], handler.queue[position:])
+	handler.queue[position] = client
+
+	client.SetPhase(PhaseQueued)
+	client.Log.WithField("queue_position", position+1).Infof("Realm is full, client queued")
+	handler.sendQueuePositions()
+
+	return nil
+}
+
+// freeSlot returns the id of an empty slot, -1 when the realm is full
+// clientsLock must be held
+func (handler *Handler) freeSlot() int {
+	for i, c := range handler.clients {
+		if c == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// assignSlot puts the client into the slot
+// clientsLock must be held
+func (handler *Handler) assignSlot(client *Client, id int) {
+	client.ID = id
+	client.Log = client.Log.WithField("client_id", id)
+	handler.clients[id] = client
+}
+
+// removeQueued takes the client out of the queue if it is waiting
+// clientsLock must be held
+func (handler *Handler) removeQueued(client *Client) {
+	for i, queued := range handler.queue {
+		if queued == client {
+			handler.queue = append(handler.queue[:i], handler.queue[i+1:]...)
+			handler.sendQueuePositions()
+			return
+		}
+	}
+}
+
+// admitQueued moves queued clients into free slots
+// the returned clients still need to enter the realm after clientsLock is released
+// clientsLock must be held
+func (handler *Handler) admitQueued() []*Client {
+	admitted := make([]*Client, 0)
+	for len(handler.queue) > 0 {
+		id := handler.freeSlot()
+		if id < 0 {
+			break
+		}
+
+		client := handler.queue[0]
+		handler.queue = handler.queue[1:]
+		if client.Disconnecting {
+			continue
+		}
+
+		handler.assignSlot(client, id)
+		admitted = append(admitted, client)
+	}
+
+	if len(admitted) > 0 {
+		handler.sendQueuePositions()
+	}
+	return admitted
+}
+
+// sendQueuePositions tells the queued clients their position
+// clientsLock must be held
+func (handler *Handler) sendQueuePositions() {
+	for i := range handler.queue {
+		handler.queue[i].PacketHandler.WritePacket(&outgoing.LoginQueue{Position: i + 1, Length: len(handler.queue)})
+	}
+}
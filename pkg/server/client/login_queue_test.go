@@ -0,0 +1,131 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+	"github.com/sirupsen/logrus"
+)
+
+// newQueueTestClient creates a logged in client without a connection
+// usernames starting with ! have queue priority
+func newQueueTestClient(username string) *Client {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	client := &Client{
+		ID:            -1,
+		Username:      username,
+		PacketHandler: NewPacketHandler(nil, DefaultSendQueueConfig),
+		Log:           logrus.NewEntry(logger),
+	}
+	if username[0] == '!' {
+		client.setRoles([]string{string(RoleModerator)})
+	} else {
+		client.setRoles(nil)
+	}
+	return client
+}
+
+// newFullHandler creates a handler with every slot taken
+func newFullHandler(queueSize int) *Handler {
+	handler := NewClientHandler(nil)
+	handler.LoginQueueSize = queueSize
+	for i := range handler.clients {
+		handler.clients[i] = &Client{ID: i}
+	}
+	return handler
+}
+
+func queuedUsernames(handler *Handler) []string {
+	usernames := make([]string, 0, len(handler.queue))
+	for _, client := range handler.queue {
+		usernames = append(usernames, client.Username)
+	}
+	return usernames
+}
+
+func TestAdmitQueueOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		logins []string
+		queue  []string
+	}{
+		{name: "players are queued in login order", logins: []string{"a", "b", "c"}, queue: []string{"a", "b", "c"}},
+		{name: "priority players skip players without priority", logins: []string{"a", "b", "!mod"}, queue: []string{"!mod", "a", "b"}},
+		{name: "priority players stay behind each other", logins: []string{"a", "!mod1", "b", "!mod2"}, queue: []string{"!mod1", "!mod2", "a", "b"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newFullHandler(DefaultLoginQueueSize)
+			for _, username := range test.logins {
+				err := handler.admit(newQueueTestClient(username))
+				if err != nil {
+					t.Fatalf("Error admitting %s: %s", username, err.Error())
+				}
+			}
+
+			if queue := queuedUsernames(handler); !reflect.DeepEqual(queue, test.queue) {
+				t.Fatalf("expected queue %v, got %v", test.queue, queue)
+			}
+
+			for i, client := range handler.queue {
+				if client.phase != PhaseQueued {
+					t.Fatalf("expected %s to be in the queued phase, got %v", client.Username, client.phase)
+				}
+
+				var last *outgoing.LoginQueue
+				for {
+					packet, _ := client.PacketHandler.sendQueue.pop()
+					if packet == nil {
+						break
+					}
+					last = packet.packet.(*outgoing.LoginQueue)
+				}
+				if last == nil || last.Position != i+1 || last.Length != len(test.queue) {
+					t.Fatalf("expected %s to be told position %d of %d, got %+v", client.Username, i+1, len(test.queue), last)
+				}
+			}
+		})
+	}
+}
+
+func TestAdmitFullQueue(t *testing.T) {
+	handler := newFullHandler(1)
+
+	err := handler.admit(newQueueTestClient("a"))
+	if err != nil {
+		t.Fatalf("Error admitting a: %s", err.Error())
+	}
+
+	err = handler.admit(newQueueTestClient("b"))
+	disconnectErr, ok := err.(*DisconnectError)
+	if !ok || disconnectErr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the realm to be full, got %v", err)
+	}
+}
+
+func TestAdmitQueued(t *testing.T) {
+	handler := newFullHandler(DefaultLoginQueueSize)
+	for _, username := range []string{"gone", "a", "b"} {
+		err := handler.admit(newQueueTestClient(username))
+		if err != nil {
+			t.Fatalf("Error admitting %s: %s", username, err.Error())
+		}
+	}
+	handler.queue[0].Disconnecting = true
+
+	handler.clients[3] = nil
+	admitted := handler.admitQueued()
+
+	if len(admitted) != 1 || admitted[0].Username != "a" || admitted[0].ID != 3 || handler.clients[3] != admitted[0] {
+		t.Fatalf("expected a to be admitted into slot 3, got %v", admitted)
+	}
+	if queue := queuedUsernames(handler); !reflect.DeepEqual(queue, []string{"b"}) {
+		t.Fatalf("expected queue [b], got %v", queue)
+	}
+}
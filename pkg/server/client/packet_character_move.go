@@ -1,5 +1,12 @@
 package client
 
+func init() {
+	RegisterIncomingPacket(func() IncomingPacket { return &CharacterMove{} }, PhaseInGame)
+	// the client sends a move every frame while moving
+	SetIncomingPacketRateLimit("CharacterMove", RateLimit{Rate: 60, Burst: 10, Policy: RateLimitDrop})
+	SetIncomingPacketMaxSize("CharacterMove", 128)
+}
+
 type CharacterMove struct {
 	Up    bool `mapstructure:"up"`
 	Down  bool `mapstructure:"down"`
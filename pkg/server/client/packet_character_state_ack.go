@@ -0,0 +1,16 @@
+package client
+
+func init() {
+	RegisterIncomingPacket(func() IncomingPacket { return &CharacterStateAck{} }, PhaseInGame)
+	SetIncomingPacketRateLimit("CharacterStateAck", RateLimit{Rate: 60, Burst: 20, Policy: RateLimitDrop})
+	SetIncomingPacketMaxSize("CharacterStateAck", 128)
+}
+
+type CharacterStateAck struct {
+	Sequence int `mapstructure:"sequence"`
+}
+
+func (packet *CharacterStateAck) Handle(client *Client) error {
+	client.snapshots.ack(packet.Sequence)
+	return nil
+}
@@ -7,6 +7,12 @@ import (
 	"github.com/pkg/errors"
 )
 
+func init() {
+	RegisterIncomingPacket(func() IncomingPacket { return &DoneLoading{} }, PhaseCharacterSelect)
+	SetIncomingPacketRateLimit("DoneLoading", RateLimit{Rate: 1, Burst: 2, Policy: RateLimitDisconnect})
+	SetIncomingPacketMaxSize("DoneLoading", 128)
+}
+
 type DoneLoading struct {
 	What string `mapstructure:"what"`
 }
@@ -15,13 +21,19 @@ func (packet *DoneLoading) Handle(client *Client) error {
 	switch packet.What {
 	case "play":
 		character := client.CharacterToLoad
+		if character == nil {
+			return errors.Errorf("No character selected to load")
+		}
 		client.CharacterToLoad = nil
 		go func() {
-			err := character.Load()
-			if err != nil {
-				character.Log.WithError(err).Errorf("Error loading character")
-				client.Disconnect(http.StatusInternalServerError, "Error loading character")
-				return
+			// a resumed character is already loaded
+			if character.isLoaded() == false {
+				err := character.Load()
+				if err != nil {
+					character.Log.WithError(err).Errorf("Error loading character")
+					client.Disconnect(http.StatusInternalServerError, "Error loading character")
+					return
+				}
 			}
 
 			client.PacketHandler.WritePacket(&outgoing.WorldData{
@@ -29,7 +41,10 @@ func (packet *DoneLoading) Handle(client *Client) error {
 				Tilemap: character.location.GetWorld().Tilemap,
 			})
 
+			client.snapshots.reset()
+			client.SetPhase(PhaseInGame)
 			client.Character = character
+			client.issueResumeToken()
 		}()
 	default:
 		return errors.Errorf("Unknown done loading %v", packet.What)
@@ -1,15 +1,18 @@
 package client
 
 import (
-	"encoding/json"
-	"reflect"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/mitchellh/mapstructure"
 	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -19,82 +22,238 @@ const (
 
 	// Ping period, must be less than pongWait
 	pingPeriod = (pongWait * 9) / 10
+
+	// the most packets written in a single message
+	maxBatchSize = 32
+
+	// messages larger than the packet limit are read up to this size so the client
+	// can be told why it is being disconnected, anything larger closes the connection
+	maxMessageSize = 64 * 1024
 )
 
 type RawIncomingPacket struct {
 	Code string                 `json:"code"`
 	Data map[string]interface{} `json:"data"`
+
+	size int // size of the message in bytes
+}
+
+type RawOutgoingPacket struct {
+	Code string                  `json:"code"`
+	Data outgoing.OutgoingPacket `json:"data"`
 }
 
 type PacketHandler struct {
 	connection *websocket.Conn
-	sendBuffer chan outgoing.OutgoingPacket
+	sendQueue  *sendQueue
 	closeData  []byte
 
-	readLock sync.Mutex
-	lastPing time.Time
+	// OnBacklog is called once when the send queue stayed full for longer than the backlog timeout
+	OnBacklog   func()
+	backlogOnce sync.Once
 
-	closed bool
+	// codecLock protects how outgoing packets are encoded
+	codecLock sync.Mutex
+	codec     Codec
+	batching  bool
+
+	latency *latencyTracker
+
+	recorderLock sync.Mutex
+	recorder     *PacketRecorder
+
+	readLock  sync.Mutex
+	readLimit int64 // accessed atomically
 }
 
-func NewPacketHandler(connection *websocket.Conn) *PacketHandler {
+func NewPacketHandler(connection *websocket.Conn, sendQueueConfig SendQueueConfig) *PacketHandler {
 	return &PacketHandler{
 		connection: connection,
-		sendBuffer: make(chan outgoing.OutgoingPacket, 64),
-		closed:     false,
+		sendQueue:  newSendQueue(sendQueueConfig),
+		codec:      codecs[JSONCodecName],
+		latency:    newLatencyTracker(),
 	}
 }
 
 func (handler *PacketHandler) Setup() {
-	handler.connection.SetReadLimit(1024) // TODO: figure out the correct size
+	handler.connection.SetReadLimit(maxMessageSize)
+	handler.SetReadLimit(maxPacketSize(PhasePreLogin))
 	handler.connection.SetPongHandler(func(appData string) error {
 		_ = handler.connection.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 }
 
+func (handler *PacketHandler) GetCodec() Codec {
+	handler.codecLock.Lock()
+	defer handler.codecLock.Unlock()
+	return handler.codec
+}
+
+// SetCodec changes the codec used for outgoing packets
+// incoming packets are decoded based on the websocket message type
+func (handler *PacketHandler) SetCodec(codec Codec) {
+	handler.codecLock.Lock()
+	defer handler.codecLock.Unlock()
+	handler.codec = codec
+}
+
+func (handler *PacketHandler) isBatching() bool {
+	handler.codecLock.Lock()
+	defer handler.codecLock.Unlock()
+	return handler.batching
+}
+
+// SetBatching lets multiple queued packets be written as an array in a single message
+func (handler *PacketHandler) SetBatching(batching bool) {
+	handler.codecLock.Lock()
+	defer handler.codecLock.Unlock()
+	handler.batching = batching
+}
+
+func (handler *PacketHandler) getRecorder() *PacketRecorder {
+	handler.recorderLock.Lock()
+	defer handler.recorderLock.Unlock()
+	return handler.recorder
+}
+
+// SetRecorder starts capturing the packets sent and received, the recorder is closed with the connection
+func (handler *PacketHandler) SetRecorder(recorder *PacketRecorder) {
+	handler.recorderLock.Lock()
+	defer handler.recorderLock.Unlock()
+	handler.recorder = recorder
+}
+
+// WritePacket queues the packet to be sent, it never blocks
+// when the client is not keeping up packets are coalesced or dropped based on their policy
 func (handler *PacketHandler) WritePacket(packet outgoing.OutgoingPacket) {
-	handler.sendBuffer <- packet
+	if handler.sendQueue.push(packet) {
+		handler.backlogOnce.Do(func() {
+			// nothing queued matters anymore, make room for the disconnect
+			handler.sendQueue.clear()
+			if handler.OnBacklog != nil {
+				handler.OnBacklog()
+			}
+		})
+	}
 }
 
 func (handler *PacketHandler) close(closeCode int, text string) {
 	handler.closeData = websocket.FormatCloseMessage(closeCode, text)
-	close(handler.sendBuffer)
+	handler.sendQueue.close()
+}
+
+// SendQueueCounters returns how many outgoing packets were dropped and coalesced
+func (handler *PacketHandler) SendQueueCounters() (dropped int, coalesced int) {
+	return handler.sendQueue.counters()
 }
 
-func (handler *PacketHandler) ProcessOutgoingPackets() bool {
-	if handler.closed {
-		return false
+// writePackets sends queued packets until the send queue is closed
+// each client has it's own writer so a slow socket only delays that client
+func (handler *PacketHandler) writePackets() {
+	pingTicker := time.NewTicker(pingPeriod)
+	defer pingTicker.Stop()
+
+	defer func() {
+		if recorder := handler.getRecorder(); recorder != nil {
+			_ = recorder.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-handler.sendQueue.notify:
+			if handler.writeQueued() == false {
+				return
+			}
+		case now := <-pingTicker.C:
+			id := handler.latency.ping(now)
+			handler.WritePacket(&outgoing.Ping{ID: id, Timestamp: now.UnixNano() / int64(time.Millisecond)})
+		}
 	}
+}
 
-	select {
-	case packet, ok := <-handler.sendBuffer:
-		_ = handler.connection.SetWriteDeadline(time.Now().Add(5 * time.Second))
-		if !ok {
-			// send channel was closed, client needs to be disconnected
+// writeQueued writes everything in the send queue
+// it returns false once the queue is closed and the connection has been closed
+func (handler *PacketHandler) writeQueued() bool {
+	for {
+		batch, closed := handler.popBatch()
+
+		if len(batch) > 0 {
+			handler.writeBatch(batch)
+		}
+
+		if closed {
+			// send queue was closed and is empty, client needs to be disconnected
+			_ = handler.connection.SetWriteDeadline(time.Now().Add(5 * time.Second))
 			_ = handler.connection.WriteMessage(websocket.CloseMessage, handler.closeData)
 			_ = handler.connection.Close()
-			handler.closed = true
 			return false
 		}
 
-		// write the current packet
-		packetName := reflect.TypeOf(packet).Elem().Name()
-		_ = handler.connection.WriteJSON(map[string]interface{}{"code": packetName, "data": packet})
-		if packetName == "PlayerDisconnect" {
-			handler.close(websocket.CloseNormalClosure, "Player Disconnecting")
-			break
+		if len(batch) == 0 {
+			return true
+		}
+	}
+}
+
+// popBatch takes the packets that can be sent in a single message
+// clients that don't support batches get a single packet
+func (handler *PacketHandler) popBatch() ([]*RawOutgoingPacket, bool) {
+	maxPackets := 1
+	if handler.isBatching() {
+		maxPackets = maxBatchSize
+	}
+
+	batch := make([]*RawOutgoingPacket, 0, maxPackets)
+	for len(batch) < maxPackets {
+		queued, closed := handler.sendQueue.pop()
+		if queued == nil {
+			return batch, closed
 		}
-	default:
-		if time.Now().Before(handler.lastPing.Add(pingPeriod)) {
-			break
+
+		batch = append(batch, &RawOutgoingPacket{Code: queued.code, Data: queued.packet})
+		if queued.code == "PlayerDisconnect" {
+			handler.close(websocket.CloseNormalClosure, "Player Disconnecting")
 		}
+	}
+
+	return batch, false
+}
+
+func (handler *PacketHandler) writeBatch(batch []*RawOutgoingPacket) {
+	codec := handler.GetCodec()
+
+	var message []byte
+	var err error
+	if len(batch) == 1 {
+		message, err = codec.Encode(batch[0])
+	} else {
+		message, err = codec.EncodeBatch(batch)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("codec", codec.Name()).WithField("batch_size", len(batch)).Errorf("Error encoding %s", batch[0].Code)
+		return
+	}
 
-		handler.lastPing = time.Now()
-		handler.WritePacket(&outgoing.Ping{})
+	_ = handler.connection.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_ = handler.connection.WriteMessage(codec.MessageType(), message)
+
+	if recorder := handler.getRecorder(); recorder != nil {
+		now := time.Now()
+		for _, packet := range batch {
+			err := recorder.Record(now, CaptureOutgoing, packet.Code, redactOutgoing(packet.Data))
+			if err != nil {
+				logrus.WithError(err).Errorf("Error capturing outgoing packet")
+			}
+		}
 	}
+}
 
-	return true
+// SetReadLimit sets the largest message that will be read
+// larger messages disconnect the client
+func (handler *PacketHandler) SetReadLimit(limit int) {
+	atomic.StoreInt64(&handler.readLimit, int64(limit))
 }
 
 func (handler *PacketHandler) ReadRawPacket(timeout time.Duration) (*RawIncomingPacket, error) {
@@ -109,57 +268,76 @@ func (handler *PacketHandler) ReadRawPacket(timeout time.Duration) (*RawIncoming
 		// setting this will break the connection when it times out
 		_ = handler.connection.SetReadDeadline(time.Now().Add(timeout))
 	}
-	_, message, err := handler.connection.ReadMessage()
+	messageType, reader, err := handler.connection.NextReader()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading message")
+	}
+
+	readLimit := atomic.LoadInt64(&handler.readLimit)
+	message, err := ioutil.ReadAll(io.LimitReader(reader, readLimit+1))
 	if err != nil {
+		if err == websocket.ErrReadLimit {
+			return nil, &DisconnectError{Code: http.StatusRequestEntityTooLarge, Message: "Packet too large"}
+		}
 		return nil, errors.Wrap(err, "Error reading message")
 	}
+	if int64(len(message)) > readLimit {
+		return nil, &DisconnectError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Packet too large, the limit is %d bytes", readLimit),
+		}
+	}
 
-	packet := &RawIncomingPacket{}
-	err = json.Unmarshal(message, packet)
+	packet := &RawIncomingPacket{size: len(message)}
+	err = codecForMessageType(messageType).Decode(message, packet)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error unmarshaling packet")
 	}
 
+	if recorder := handler.getRecorder(); recorder != nil {
+		err = recorder.Record(time.Now(), CaptureIncoming, packet.Code, packet.Data)
+		if err != nil {
+			logrus.WithError(err).Errorf("Error capturing incoming packet")
+		}
+	}
+
 	return packet, nil
 }
 
 func (handler *PacketHandler) processIncomingPackets(client *Client) error {
 	packet, err := handler.ReadRawPacket(-1)
 	if err != nil {
-		if client.Disconnecting {
+		if client.Disconnecting || client.isDetached() {
 			return nil
 		}
 
-		return errors.Wrap(err, "Error reading packet")
+		if _, ok := err.(*DisconnectError); ok {
+			return err
+		}
+
+		// the connection is gone, the session can still be resumed
+		client.Log.WithError(err).Infof("Error reading packet")
+		return &DisconnectError{Code: StatusClientClosedRequest, Message: "Client disconnected"}
+	}
+
+	allowed, err := client.rateLimiter.allow(client, packet.Code)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return nil
 	}
 
-	// TODO: only process packets that were sent once a frame or less (60/1000ms)
-	//  what do we do with packets sent faster than that?
+	if permission := incomingPacketPermission(packet.Code); len(permission) > 0 && !client.HasPermission(permission) {
+		client.Log.WithField("permission", permission).Warnf("Packet %s sent without permission", packet.Code)
+		return &DisconnectError{Code: http.StatusForbidden, Message: "You don't have permission to do that"}
+	}
 
-	switch packet.Code {
-	case reflect.TypeOf(CharacterMove{}).Name():
-		playerMove := &CharacterMove{}
-		err := mapstructure.Decode(packet.Data, playerMove)
-		if err != nil {
-			return errors.Wrap(err, "Error decoding CharacterMove")
-		}
-		return playerMove.Handle(client)
-	case reflect.TypeOf(InterfaceButtonClick{}).Name():
-		interfaceButtonClick := &InterfaceButtonClick{}
-		err := mapstructure.Decode(packet.Data, interfaceButtonClick)
-		if err != nil {
-			return errors.Wrap(err, "Error decoding InterfaceButtonClick")
-		}
-		return interfaceButtonClick.Handle(client)
-	case reflect.TypeOf(DoneLoading{}).Name():
-		doneLoading := &DoneLoading{}
-		err := mapstructure.Decode(packet.Data, doneLoading)
-		if err != nil {
-			return errors.Wrap(err, "Error decoding DoneLoading")
-		}
-		return doneLoading.Handle(client)
-	default:
-		client.Log.Errorf("Unknown Packet code: %s: %s", packet.Code, packet.Data)
-		return errors.Errorf("Unknown Packet code: %s", packet.Code)
+	incomingPacket, err := decodeIncomingPacket(packet, client.GetPhase())
+	if err != nil {
+		client.Log.Errorf("Invalid packet %s: %s", packet.Code, packet.Data)
+		return err
 	}
+
+	return incomingPacket.Handle(client)
 }
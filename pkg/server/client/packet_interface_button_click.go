@@ -5,6 +5,13 @@ import (
 	"github.com/pkg/errors"
 )
 
+func init() {
+	RegisterIncomingPacket(func() IncomingPacket { return &InterfaceButtonClick{} }, PhaseCharacterSelect, PhaseInGame)
+	// cooldown to prevent players from spam clicking
+	SetIncomingPacketRateLimit("InterfaceButtonClick", RateLimit{Rate: 4, Burst: 4, Policy: RateLimitDrop})
+	SetIncomingPacketMaxSize("InterfaceButtonClick", 128)
+}
+
 type InterfaceButtonClick struct {
 	InterfaceID int `mapstructure:"interface_id"`
 	ButtonID    int `mapstructure:"button_id"`
@@ -12,8 +19,6 @@ type InterfaceButtonClick struct {
 
 func (packet *InterfaceButtonClick) Handle(client *Client) error {
 
-	// TODO: button clicks need a cooldown to prevent players from spam clicking
-
 	client.Log.Infof("Button Clicked %v:%v", packet.InterfaceID, packet.ButtonID)
 	switch packet.InterfaceID {
 	case 2:
@@ -22,6 +27,10 @@ func (packet *InterfaceButtonClick) Handle(client *Client) error {
 			return nil
 		}
 
+		if packet.ButtonID < 0 || packet.ButtonID >= len(client.Characters) {
+			return errors.Errorf("Unknown character slot %v", packet.ButtonID)
+		}
+
 		character := client.Characters[packet.ButtonID]
 		if character == nil {
 			//TODO: open character creation interface
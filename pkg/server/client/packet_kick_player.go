@@ -0,0 +1,36 @@
+package client
+
+import (
+	"net/http"
+)
+
+func init() {
+	RegisterIncomingPacket(func() IncomingPacket { return &KickPlayer{} }, PhaseCharacterSelect, PhaseInGame)
+	SetIncomingPacketRateLimit("KickPlayer", RateLimit{Rate: 1, Burst: 5, Policy: RateLimitDrop})
+	SetIncomingPacketMaxSize("KickPlayer", 512)
+	SetIncomingPacketPermission("KickPlayer", PermissionKickPlayers)
+}
+
+// KickPlayer disconnects another player, only players with PermissionKickPlayers can send it
+type KickPlayer struct {
+	Username string `mapstructure:"username"`
+	Message  string `mapstructure:"message"`
+}
+
+func (packet *KickPlayer) Handle(client *Client) error {
+	target := client.clientHandler.getOtherClientByUsername(packet.Username, client)
+	if target == nil {
+		client.Log.WithField("kick_username", packet.Username).Warnf("Player to kick is not logged in")
+		return nil
+	}
+
+	message := "Kicked from the realm"
+	if len(packet.Message) > 0 {
+		message += ": " + packet.Message
+	}
+
+	client.Log.WithField("kick_username", packet.Username).WithField("kick_message", packet.Message).Infof("Kicking player")
+	target.Log.WithField("kicked_by", client.Username).Infof("Player was kicked")
+	target.kick(http.StatusForbidden, message)
+	return nil
+}
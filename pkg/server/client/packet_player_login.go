@@ -1,7 +1,18 @@
 package client
 
+func init() {
+	RegisterIncomingPacket(func() IncomingPacket { return &PlayerLogin{} }, PhasePreLogin)
+	SetIncomingPacketMaxSize("PlayerLogin", 4096)
+}
+
 type PlayerLogin struct {
+	ProtocolVersion int      `mapstructure:"protocol_version"`
+	Capabilities    []string `mapstructure:"capabilities"`
+
 	AccessToken string `mapstructure:"access_token"`
+	Username    string `mapstructure:"username"` // used instead of the access token when dev logins are allowed
+	Codec       string `mapstructure:"codec"`    // codec for outgoing packets, defaults to json
+	ResumeToken string `mapstructure:"resume_token"`
 	Screen      struct {
 		Width  int `mapstructure:"width"`
 		Height int `mapstructure:"height"`
@@ -0,0 +1,30 @@
+package client
+
+import "time"
+
+func init() {
+	RegisterIncomingPacket(func() IncomingPacket { return &Pong{} }, PhaseQueued, PhaseCharacterSelect, PhaseInGame)
+	SetIncomingPacketRateLimit("Pong", RateLimit{Rate: 1, Burst: 4, Policy: RateLimitDrop})
+	SetIncomingPacketMaxSize("Pong", 128)
+}
+
+type Pong struct {
+	ID        int   `mapstructure:"id"`
+	Timestamp int64 `mapstructure:"timestamp"`
+}
+
+func (packet *Pong) Handle(client *Client) error {
+	if client.PacketHandler.latency.pong(packet.ID, time.Now()) == false {
+		// late or made up pong
+		return nil
+	}
+
+	latency := client.GetLatency()
+	client.Log.WithField("rtt", latency.RTT).WithField("jitter", latency.Jitter).Debugf("Client latency")
+	if client.GetPhase() != PhaseQueued {
+		// queued clients don't have a player id yet
+		client.PacketHandler.WritePacket(client.playerInfo())
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// Phase is the stage of the connection a client is in
+// packets are only accepted in the phases they are registered for
+type Phase int
+
+const (
+	PhasePreLogin Phase = iota
+	PhaseQueued         // waiting for a free slot in the realm
+	PhaseCharacterSelect
+	PhaseInGame
+)
+
+func (phase Phase) String() string {
+	switch phase {
+	case PhasePreLogin:
+		return "PreLogin"
+	case PhaseQueued:
+		return "Queued"
+	case PhaseCharacterSelect:
+		return "CharacterSelect"
+	case PhaseInGame:
+		return "InGame"
+	default:
+		return "Unknown"
+	}
+}
+
+// IncomingPacket is a packet sent by the client
+type IncomingPacket interface {
+	Handle(client *Client) error
+}
+
+// IncomingPacketDecoder fills the packet with the raw data sent by the client
+type IncomingPacketDecoder func(data map[string]interface{}, packet IncomingPacket) error
+
+// defaultMaxPacketSize is the largest message in bytes for packets without their own limit
+const defaultMaxPacketSize = 1024
+
+type incomingPacketRegistration struct {
+	code    string
+	new     func() IncomingPacket
+	decode  IncomingPacketDecoder
+	phases  []Phase
+	maxSize int
+
+	// permission needed to send the packet, empty allows everybody
+	permission Permission
+}
+
+func (registration *incomingPacketRegistration) allowedIn(phase Phase) bool {
+	for _, p := range registration.phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+var incomingPackets = make(map[string]*incomingPacketRegistration)
+
+// MapstructureDecoder is the default decoder for incoming packets
+func MapstructureDecoder(data map[string]interface{}, packet IncomingPacket) error {
+	return mapstructure.Decode(data, packet)
+}
+
+// RegisterIncomingPacket registers a packet using the default decoder
+// the packet code is the name of the packet type
+func RegisterIncomingPacket(newPacket func() IncomingPacket, phases ...Phase) {
+	RegisterIncomingPacketWithDecoder(newPacket, MapstructureDecoder, phases...)
+}
+
+// RegisterIncomingPacketWithDecoder registers a packet with a custom decoder
+func RegisterIncomingPacketWithDecoder(newPacket func() IncomingPacket, decoder IncomingPacketDecoder, phases ...Phase) {
+	code := reflect.TypeOf(newPacket()).Elem().Name()
+	if _, ok := incomingPackets[code]; ok {
+		panic("incoming packet " + code + " is already registered")
+	}
+
+	incomingPackets[code] = &incomingPacketRegistration{
+		code:    code,
+		new:     newPacket,
+		decode:  decoder,
+		phases:  phases,
+		maxSize: defaultMaxPacketSize,
+	}
+}
+
+// SetIncomingPacketMaxSize sets the largest message in bytes allowed for a registered packet code
+func SetIncomingPacketMaxSize(code string, size int) {
+	registration, ok := incomingPackets[code]
+	if !ok {
+		panic("incoming packet " + code + " is not registered")
+	}
+	registration.maxSize = size
+}
+
+// SetIncomingPacketPermission only allows players with the permission to send the registered packet code
+// other players are disconnected when they send it
+func SetIncomingPacketPermission(code string, permission Permission) {
+	registration, ok := incomingPackets[code]
+	if !ok {
+		panic("incoming packet " + code + " is not registered")
+	}
+	registration.permission = permission
+}
+
+// incomingPacketPermission returns the permission needed to send the packet code
+func incomingPacketPermission(code string) Permission {
+	registration, ok := incomingPackets[code]
+	if !ok {
+		return ""
+	}
+	return registration.permission
+}
+
+// maxPacketSize is the largest message allowed for any packet in the phase
+func maxPacketSize(phase Phase) int {
+	size := 0
+	for _, registration := range incomingPackets {
+		if registration.allowedIn(phase) && registration.maxSize > size {
+			size = registration.maxSize
+		}
+	}
+	return size
+}
+
+// RegisteredIncomingPackets returns an empty packet of every registered code sorted by code
+func RegisteredIncomingPackets() []IncomingPacket {
+	codes := make([]string, 0, len(incomingPackets))
+	for code := range incomingPackets {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	packets := make([]IncomingPacket, 0, len(codes))
+	for _, code := range codes {
+		packets = append(packets, incomingPackets[code].new())
+	}
+	return packets
+}
+
+// decodeIncomingPacket looks up the registered packet for the raw packet code
+// and decodes it if it is allowed in the given phase
+func decodeIncomingPacket(rawPacket *RawIncomingPacket, phase Phase) (IncomingPacket, error) {
+	registration, ok := incomingPackets[rawPacket.Code]
+	if !ok {
+		return nil, errors.Errorf("Unknown Packet code: %s", rawPacket.Code)
+	}
+
+	if registration.allowedIn(phase) == false {
+		return nil, errors.Errorf("Packet %s is not allowed in phase %s", rawPacket.Code, phase)
+	}
+
+	if rawPacket.size > registration.maxSize {
+		return nil, &DisconnectError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Packet %s too large, the limit is %d bytes", rawPacket.Code, registration.maxSize),
+		}
+	}
+
+	packet := registration.new()
+	err := registration.decode(rawPacket.Data, packet)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error decoding %s", rawPacket.Code)
+	}
+
+	return packet, nil
+}
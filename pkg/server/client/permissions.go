@@ -0,0 +1,70 @@
+package client
+
+import (
+	"sort"
+)
+
+// Role is given to a player by the roles claim of their access token
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+)
+
+// Permission allows a player to use an admin feature
+type Permission string
+
+const (
+	// PermissionKickPlayers allows sending KickPlayer to disconnect other players
+	PermissionKickPlayers Permission = "kick_players"
+
+	// PermissionQueuePriority moves the player ahead of other players in the login queue
+	PermissionQueuePriority Permission = "queue_priority"
+)
+
+// the permissions each role grants, roles not listed grant nothing
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin:     {PermissionKickPlayers, PermissionQueuePriority},
+	RoleModerator: {PermissionKickPlayers, PermissionQueuePriority},
+}
+
+// SetRolePermissions replaces the permissions granted by the role
+// this must be called before clients connect
+func SetRolePermissions(role Role, permissions ...Permission) {
+	rolePermissions[role] = permissions
+}
+
+// setRoles sets the roles of the player from their access token
+func (c *Client) setRoles(roles []string) {
+	c.roles = make(map[Role]bool)
+	c.permissions = make(map[Permission]bool)
+	for _, name := range roles {
+		role := Role(name)
+		c.roles[role] = true
+		for _, permission := range rolePermissions[role] {
+			c.permissions[permission] = true
+		}
+	}
+}
+
+// Roles returns the roles of the player sorted by name
+func (c *Client) Roles() []Role {
+	roles := make([]Role, 0, len(c.roles))
+	for role := range c.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i] < roles[j]
+	})
+	return roles
+}
+
+func (c *Client) HasRole(role Role) bool {
+	return c.roles[role]
+}
+
+// HasPermission returns if any role of the player grants the permission
+func (c *Client) HasPermission(permission Permission) bool {
+	return c.permissions[permission]
+}
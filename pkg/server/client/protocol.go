@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ProtocolVersion is the version of the packets sent between the realm and the client
+// increase it whenever a change would break older clients
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest client protocol version the realm still accepts
+const MinProtocolVersion = 1
+
+const (
+	CapabilityDeltaState    = "delta_state"
+	CapabilitySessionResume = "session_resume"
+	CapabilityBatch         = "batch"
+)
+
+// Capabilities are optional features, they are only used if both the realm and the client support them
+var Capabilities = []string{
+	CapabilityDeltaState,
+	CapabilitySessionResume,
+	CapabilityBatch,
+}
+
+// checkProtocolVersion returns a DisconnectError when the client protocol is not supported
+func checkProtocolVersion(version int) error {
+	if version < MinProtocolVersion {
+		return &DisconnectError{
+			Code:    http.StatusUpgradeRequired,
+			Message: fmt.Sprintf("Your client is out of date (protocol %d, realm requires %d), please refresh the page", version, MinProtocolVersion),
+		}
+	}
+
+	if version > ProtocolVersion {
+		return &DisconnectError{
+			Code:    http.StatusUpgradeRequired,
+			Message: fmt.Sprintf("This realm is out of date (protocol %d, client uses %d), please try again later", ProtocolVersion, version),
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) setCapabilities(capabilities []string) {
+	c.capabilities = make(map[string]bool)
+	for _, capability := range Capabilities {
+		for _, clientCapability := range capabilities {
+			if capability == clientCapability {
+				c.capabilities[capability] = true
+			}
+		}
+	}
+}
+
+// HasCapability is true when both the realm and the client support the capability
+func (c *Client) HasCapability(capability string) bool {
+	return c.capabilities[capability]
+}
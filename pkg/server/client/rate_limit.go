@@ -0,0 +1,193 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// how often the rate limit counters are logged for a packet code that keeps getting limited
+const rateLimitLogPeriod = 10 * time.Second
+
+type RateLimitPolicy int
+
+const (
+	// RateLimitDrop ignores packets sent over the limit
+	RateLimitDrop RateLimitPolicy = iota
+	// RateLimitDelay waits until the packet is allowed before handling it
+	RateLimitDelay
+	// RateLimitDisconnect disconnects the client
+	RateLimitDisconnect
+)
+
+func (policy RateLimitPolicy) String() string {
+	switch policy {
+	case RateLimitDrop:
+		return "drop"
+	case RateLimitDelay:
+		return "delay"
+	case RateLimitDisconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// RateLimit is a token bucket refilled with Rate tokens per second holding at most Burst tokens
+type RateLimit struct {
+	Rate   float64
+	Burst  int
+	Policy RateLimitPolicy
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+
+	limited   int
+	lastLog   time.Time
+	loggedNum int
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+// take removes a token from the bucket
+// if there is no token it returns how long until one is available
+func (bucket *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.limit.Rate
+	if bucket.tokens > float64(bucket.limit.Burst) {
+		bucket.tokens = float64(bucket.limit.Burst)
+	}
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / bucket.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// rateLimiter limits the packets a single client can send
+// there is a bucket for the client and one for each packet code
+type rateLimiter struct {
+	lock sync.Mutex
+
+	client  *tokenBucket
+	packets map[string]*tokenBucket
+}
+
+func newRateLimiter(clientLimit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		client:  newTokenBucket(clientLimit),
+		packets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow checks the packet limit and then the client limit
+// packets dropped by their packet limit don't count against the client limit
+// it returns false if the packet should be dropped
+// or a DisconnectError if the client should be disconnected
+func (limiter *rateLimiter) allow(client *Client, code string) (bool, error) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if limit, ok := incomingPacketRateLimits[code]; ok {
+		bucket, ok := limiter.packets[code]
+		if !ok {
+			bucket = newTokenBucket(limit)
+			limiter.packets[code] = bucket
+		}
+
+		allowed, err := limiter.take(client, code, bucket)
+		if !allowed || err != nil {
+			return allowed, err
+		}
+	}
+
+	return limiter.take(client, "*", limiter.client)
+}
+
+// take removes a token from the bucket and applies the bucket policy if there was none
+func (limiter *rateLimiter) take(client *Client, code string, bucket *tokenBucket) (bool, error) {
+	now := time.Now()
+	ok, wait := bucket.take(now)
+	if ok {
+		return true, nil
+	}
+
+	limiter.logLimited(client, code, bucket, now)
+
+	switch bucket.limit.Policy {
+	case RateLimitDelay:
+		// each client reads on its own goroutine so this only slows down this client
+		limiter.lock.Unlock()
+		time.Sleep(wait)
+		limiter.lock.Lock()
+		_, _ = bucket.take(time.Now())
+		return true, nil
+	case RateLimitDisconnect:
+		return false, &DisconnectError{Code: http.StatusTooManyRequests, Message: "Too many packets sent"}
+	default:
+		return false, nil
+	}
+}
+
+func (limiter *rateLimiter) logLimited(client *Client, code string, bucket *tokenBucket, now time.Time) {
+	bucket.limited++
+	if now.Sub(bucket.lastLog) < rateLimitLogPeriod {
+		return
+	}
+
+	client.Log.WithFields(logrus.Fields{
+		"packet_code":      code,
+		"rate_limit":       bucket.limit.Rate,
+		"rate_burst":       bucket.limit.Burst,
+		"rate_policy":      bucket.limit.Policy.String(),
+		"limited_total":    bucket.limited,
+		"limited_recently": bucket.limited - bucket.loggedNum,
+	}).Warnf("Client is sending packets too fast")
+
+	bucket.lastLog = now
+	bucket.loggedNum = bucket.limited
+}
+
+// logCounters logs how many packets of each code were limited
+func (limiter *rateLimiter) logCounters(client *Client) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	fields := logrus.Fields{}
+	if limiter.client.limited > 0 {
+		fields["limited_*"] = limiter.client.limited
+	}
+	for code, bucket := range limiter.packets {
+		if bucket.limited > 0 {
+			fields["limited_"+code] = bucket.limited
+		}
+	}
+
+	if len(fields) > 0 {
+		client.Log.WithFields(fields).Infof("Client rate limit counters")
+	}
+}
+
+var incomingPacketRateLimits = make(map[string]RateLimit)
+
+// SetIncomingPacketRateLimit sets the rate limit for a registered packet code
+func SetIncomingPacketRateLimit(code string, limit RateLimit) {
+	if _, ok := incomingPackets[code]; !ok {
+		panic("incoming packet " + code + " is not registered")
+	}
+	incomingPacketRateLimits[code] = limit
+}
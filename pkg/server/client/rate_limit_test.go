@@ -0,0 +1,116 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   RateLimit
+		takes   []time.Duration // time of each take since the bucket was created
+		allowed []bool
+		wait    time.Duration // wait returned by the last take
+	}{
+		{
+			name:    "burst is allowed at once",
+			limit:   RateLimit{Rate: 1, Burst: 3},
+			takes:   []time.Duration{0, 0, 0},
+			allowed: []bool{true, true, true},
+		},
+		{
+			name:    "takes over the burst wait for the next token",
+			limit:   RateLimit{Rate: 2, Burst: 2},
+			takes:   []time.Duration{0, 0, 0},
+			allowed: []bool{true, true, false},
+			wait:    500 * time.Millisecond,
+		},
+		{
+			name:    "tokens are refilled at the rate",
+			limit:   RateLimit{Rate: 2, Burst: 1},
+			takes:   []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond},
+			allowed: []bool{true, false, true},
+		},
+		{
+			name:    "refilled tokens are capped at the burst",
+			limit:   RateLimit{Rate: 10, Burst: 2},
+			takes:   []time.Duration{0, 0, 10 * time.Second, 10 * time.Second, 10 * time.Second},
+			allowed: []bool{true, true, true, true, false},
+			wait:    100 * time.Millisecond,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			bucket := newTokenBucket(test.limit)
+			bucket.last = start
+
+			var wait time.Duration
+			for i, offset := range test.takes {
+				var allowed bool
+				allowed, wait = bucket.take(start.Add(offset))
+				if allowed != test.allowed[i] {
+					t.Fatalf("take %d: expected allowed to be %v, got %v", i, test.allowed[i], allowed)
+				}
+			}
+
+			if wait != test.wait {
+				t.Fatalf("expected a wait of %s, got %s", test.wait, wait)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		clientLimit RateLimit
+		code        string
+		packets     int
+		allowed     int
+		disconnect  bool
+	}{
+		{name: "packets without a limit only use the client limit", clientLimit: RateLimit{Rate: 1, Burst: 10}, code: "PlayerLogin", packets: 12, allowed: 10},
+		{name: "packet limits drop packets over their burst", clientLimit: RateLimit{Rate: 1, Burst: 100}, code: "Pong", packets: 6, allowed: 4},
+		{name: "the client limit applies to packets within their packet limit", clientLimit: RateLimit{Rate: 1, Burst: 2}, code: "Pong", packets: 6, allowed: 2},
+		{name: "packets dropped by their packet limit don't count against the client limit", clientLimit: RateLimit{Rate: 1, Burst: 5, Policy: RateLimitDisconnect}, code: "Pong", packets: 10, allowed: 4},
+		{name: "disconnect policy returns a disconnect error", clientLimit: RateLimit{Rate: 1, Burst: 100}, code: "DoneLoading", packets: 3, allowed: 2, disconnect: true},
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	client := &Client{Log: logrus.NewEntry(logger)}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := newRateLimiter(test.clientLimit)
+
+			allowed := 0
+			disconnected := false
+			for i := 0; i < test.packets; i++ {
+				ok, err := limiter.allow(client, test.code)
+				if err != nil {
+					disconnectErr, isDisconnect := err.(*DisconnectError)
+					if !test.disconnect || !isDisconnect || disconnectErr.Code != http.StatusTooManyRequests {
+						t.Fatalf("unexpected error %v", err)
+					}
+					disconnected = true
+					break
+				}
+				if ok {
+					allowed++
+				}
+			}
+
+			if allowed != test.allowed || disconnected != test.disconnect {
+				t.Fatalf("expected %d packets to be allowed and disconnect %v, got %d and %v", test.allowed, test.disconnect, allowed, disconnected)
+			}
+		})
+	}
+}
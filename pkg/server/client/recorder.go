@@ -0,0 +1,106 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+	"github.com/pkg/errors"
+)
+
+const (
+	CaptureIncoming = "in"
+	CaptureOutgoing = "out"
+)
+
+// login fields that are not written to captures
+var redactedLoginFields = []string{"access_token", "resume_token"}
+
+// CapturedPacket is a single line in a capture file
+type CapturedPacket struct {
+	Time      time.Time   `json:"time"`
+	Direction string      `json:"direction"`
+	Code      string      `json:"code"`
+	Data      interface{} `json:"data"`
+}
+
+// PacketRecorder writes the packets of a client to a capture file, one json packet per line
+type PacketRecorder struct {
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewPacketRecorder creates a capture file for the username in the directory
+func NewPacketRecorder(dir string, username string) (*PacketRecorder, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating capture directory")
+	}
+
+	name := filepath.Join(dir, fmt.Sprintf("%s-%d.jsonl", filepath.Base(username), time.Now().Unix()))
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating capture file")
+	}
+
+	return &PacketRecorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+func (recorder *PacketRecorder) Name() string {
+	return recorder.file.Name()
+}
+
+// Record writes the packet to the capture file
+func (recorder *PacketRecorder) Record(at time.Time, direction string, code string, data interface{}) error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	if recorder.encoder == nil {
+		return nil
+	}
+
+	return recorder.encoder.Encode(&CapturedPacket{Time: at, Direction: direction, Code: code, Data: data})
+}
+
+func (recorder *PacketRecorder) Close() error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	if recorder.encoder == nil {
+		return nil
+	}
+	recorder.encoder = nil
+	return recorder.file.Close()
+}
+
+// redactLogin copies the login packet data without the tokens
+func redactLogin(data map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		redacted[key] = value
+	}
+	for _, key := range redactedLoginFields {
+		if _, ok := redacted[key]; ok {
+			redacted[key] = ""
+		}
+	}
+	return redacted
+}
+
+// redactOutgoing copies outgoing packet data that contains tokens without them
+func redactOutgoing(data outgoing.OutgoingPacket) outgoing.OutgoingPacket {
+	if resume, ok := data.(*outgoing.SessionResume); ok {
+		redacted := *resume
+		redacted.Token = ""
+		return &redacted
+	}
+	return data
+}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+)
+
+func TestRedactOutgoing(t *testing.T) {
+	resume := &outgoing.SessionResume{Token: "secret", GracePeriod: 30}
+
+	redacted, ok := redactOutgoing(resume).(*outgoing.SessionResume)
+	if !ok || redacted.Token != "" || redacted.GracePeriod != 30 {
+		t.Fatalf("expected the resume token to be blanked, got %+v", redacted)
+	}
+	if resume.Token != "secret" {
+		t.Fatalf("expected the sent packet to keep its token, got %q", resume.Token)
+	}
+
+	queue := &outgoing.LoginQueue{Position: 1, Length: 2}
+	if redactOutgoing(queue) != queue {
+		t.Fatalf("expected packets without tokens to be recorded as sent")
+	}
+}
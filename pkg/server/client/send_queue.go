@@ -0,0 +1,215 @@
+package client
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+)
+
+type PacketPriority int
+
+const (
+	// PriorityLow packets are dropped when the send queue is full
+	PriorityLow PacketPriority = iota
+	// PriorityNormal packets are queued as long as the queue has room
+	PriorityNormal
+	// PriorityHigh packets are always queued
+	PriorityHigh
+)
+
+// OutgoingPacketPolicy is how a packet code is queued when the client is not keeping up
+type OutgoingPacketPolicy struct {
+	Priority PacketPriority
+
+	// CoalesceGroup packets replace a queued packet of the same group that was not sent yet
+	// empty means the packet is never coalesced
+	CoalesceGroup string
+}
+
+var outgoingPacketPolicies = map[string]OutgoingPacketPolicy{
+	"Ping": {Priority: PriorityLow, CoalesceGroup: "Ping"},
+
+	// state packets are superseded by the next one, deltas are against an acknowledged snapshot
+	// so replacing them is safe
+	"LocalCharacterState": {Priority: PriorityLow, CoalesceGroup: "CharacterState"},
+	"CharacterStateDelta": {Priority: PriorityLow, CoalesceGroup: "CharacterState"},
+
+	"PlayerDisconnect": {Priority: PriorityHigh},
+}
+
+// SetOutgoingPacketPolicy sets the queue policy for an outgoing packet code
+// packets without a policy are PriorityNormal and never coalesced
+func SetOutgoingPacketPolicy(code string, policy OutgoingPacketPolicy) {
+	outgoingPacketPolicies[code] = policy
+}
+
+// SendQueueConfig configures the outgoing packet queue of each client
+type SendQueueConfig struct {
+	// MaxQueued is the number of queued packets before low priority packets are dropped
+	// and normal priority packets are considered backlogged
+	MaxQueued int
+
+	// BacklogTimeout is how long the queue can stay full before the client is disconnected
+	BacklogTimeout time.Duration
+}
+
+var DefaultSendQueueConfig = SendQueueConfig{
+	MaxQueued:      64,
+	BacklogTimeout: 10 * time.Second,
+}
+
+type queuedPacket struct {
+	code   string
+	policy OutgoingPacketPolicy
+	packet outgoing.OutgoingPacket
+}
+
+// sendQueue is a non-blocking queue of outgoing packets
+type sendQueue struct {
+	lock   sync.Mutex
+	config SendQueueConfig
+
+	packets []*queuedPacket
+	closed  bool
+
+	// notify has a value when packets were queued or the queue was closed
+	notify chan struct{}
+
+	backlogSince time.Time
+	dropped      int
+	coalesced    int
+}
+
+func newSendQueue(config SendQueueConfig) *sendQueue {
+	return &sendQueue{
+		config:  config,
+		packets: make([]*queuedPacket, 0, config.MaxQueued),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// signal wakes up the writer without blocking, the lock must be held
+func (queue *sendQueue) signal() {
+	select {
+	case queue.notify <- struct{}{}:
+	default:
+		// writer was already signaled
+	}
+}
+
+// push queues the packet without blocking
+// it returns true when the queue has been backlogged for longer than the backlog timeout
+func (queue *sendQueue) push(packet outgoing.OutgoingPacket) bool {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	if queue.closed {
+		return false
+	}
+
+	code := reflect.TypeOf(packet).Elem().Name()
+	policy, ok := outgoingPacketPolicies[code]
+	if !ok {
+		policy = OutgoingPacketPolicy{Priority: PriorityNormal}
+	}
+	queued := &queuedPacket{code: code, policy: policy, packet: packet}
+	defer queue.signal()
+
+	if !queue.coalesce(queued) {
+		switch {
+		case len(queue.packets) < queue.config.MaxQueued || policy.Priority == PriorityHigh:
+			queue.packets = append(queue.packets, queued)
+		case policy.Priority == PriorityLow:
+			queue.dropped++
+		default:
+			// make room by dropping a low priority packet, if there are none the queue grows
+			// until the client catches up or the backlog timeout disconnects it
+			queue.dropLowPriority()
+			queue.packets = append(queue.packets, queued)
+		}
+	}
+
+	// the queue stays backlogged while it is full, even when packets only replace each other
+	if len(queue.packets) < queue.config.MaxQueued {
+		return false
+	}
+	if queue.backlogSince.IsZero() {
+		queue.backlogSince = time.Now()
+	}
+	return time.Since(queue.backlogSince) > queue.config.BacklogTimeout
+}
+
+// coalesce replaces a queued packet of the same coalesce group, the lock must be held
+func (queue *sendQueue) coalesce(queued *queuedPacket) bool {
+	if len(queued.policy.CoalesceGroup) == 0 {
+		return false
+	}
+	for i, other := range queue.packets {
+		if other.policy.CoalesceGroup == queued.policy.CoalesceGroup {
+			queue.packets[i] = queued
+			queue.coalesced++
+			return true
+		}
+	}
+	return false
+}
+
+// dropLowPriority removes the oldest low priority packet, the lock must be held
+func (queue *sendQueue) dropLowPriority() {
+	for i, other := range queue.packets {
+		if other.policy.Priority == PriorityLow {
+			queue.packets = append(queue.packets[:i], queue.packets[i+1:]...)
+			queue.dropped++
+			return
+		}
+	}
+}
+
+// pop returns the next packet to send or nil if there are none
+// closed is true once the queue is closed and all packets have been sent
+func (queue *sendQueue) pop() (packet *queuedPacket, closed bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	if len(queue.packets) == 0 {
+		return nil, queue.closed
+	}
+
+	packet = queue.packets[0]
+	queue.packets[0] = nil
+	queue.packets = queue.packets[1:]
+
+	if len(queue.packets) < queue.config.MaxQueued {
+		queue.backlogSince = time.Time{}
+	}
+
+	return packet, false
+}
+
+// clear removes all queued packets
+func (queue *sendQueue) clear() {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	queue.dropped += len(queue.packets)
+	queue.packets = queue.packets[:0]
+	queue.backlogSince = time.Time{}
+}
+
+// close stops accepting packets, queued packets are still sent
+func (queue *sendQueue) close() {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	queue.closed = true
+	queue.signal()
+}
+
+func (queue *sendQueue) counters() (int, int) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	return queue.dropped, queue.coalesced
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+)
+
+func TestSendQueue(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxQueued int
+		pushes    []outgoing.OutgoingPacket
+		sent      []string
+		dropped   int
+		coalesced int
+	}{
+		{
+			name:      "packets are sent in order",
+			maxQueued: 4,
+			pushes:    []outgoing.OutgoingPacket{&outgoing.PlayerInfo{}, &outgoing.Ping{}, &outgoing.LoginQueue{}},
+			sent:      []string{"PlayerInfo", "Ping", "LoginQueue"},
+		},
+		{
+			name:      "packets of a coalesce group replace the queued one in place",
+			maxQueued: 4,
+			pushes:    []outgoing.OutgoingPacket{&outgoing.LocalCharacterState{}, &outgoing.PlayerInfo{}, &outgoing.CharacterStateDelta{Sequence: 2}},
+			sent:      []string{"CharacterStateDelta", "PlayerInfo"},
+			coalesced: 1,
+		},
+		{
+			name:      "low priority packets are dropped when the queue is full",
+			maxQueued: 2,
+			pushes:    []outgoing.OutgoingPacket{&outgoing.PlayerInfo{}, &outgoing.LoginQueue{}, &outgoing.Ping{}},
+			sent:      []string{"PlayerInfo", "LoginQueue"},
+			dropped:   1,
+		},
+		{
+			name:      "normal priority packets make room by dropping the oldest low priority packet",
+			maxQueued: 2,
+			pushes:    []outgoing.OutgoingPacket{&outgoing.Ping{}, &outgoing.PlayerInfo{}, &outgoing.LoginQueue{}},
+			sent:      []string{"PlayerInfo", "LoginQueue"},
+			dropped:   1,
+		},
+		{
+			name:      "normal priority packets grow the queue when nothing can be dropped",
+			maxQueued: 1,
+			pushes:    []outgoing.OutgoingPacket{&outgoing.PlayerInfo{}, &outgoing.LoginQueue{}},
+			sent:      []string{"PlayerInfo", "LoginQueue"},
+		},
+		{
+			name:      "high priority packets are always queued",
+			maxQueued: 1,
+			pushes:    []outgoing.OutgoingPacket{&outgoing.Ping{}, &outgoing.PlayerDisconnect{}},
+			sent:      []string{"Ping", "PlayerDisconnect"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := newSendQueue(SendQueueConfig{MaxQueued: test.maxQueued, BacklogTimeout: time.Minute})
+			for _, packet := range test.pushes {
+				if queue.push(packet) {
+					t.Fatalf("push reported a backlog timeout")
+				}
+			}
+			queue.close()
+
+			sent := make([]string, 0)
+			for {
+				packet, closed := queue.pop()
+				if closed {
+					break
+				}
+				sent = append(sent, packet.code)
+			}
+
+			if !reflect.DeepEqual(sent, test.sent) {
+				t.Fatalf("expected %v to be sent, got %v", test.sent, sent)
+			}
+			dropped, coalesced := queue.counters()
+			if dropped != test.dropped || coalesced != test.coalesced {
+				t.Fatalf("expected %d dropped and %d coalesced, got %d and %d", test.dropped, test.coalesced, dropped, coalesced)
+			}
+		})
+	}
+}
+
+func TestSendQueueBacklogTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		push       outgoing.OutgoingPacket
+		popFirst   bool
+		backlogged bool
+	}{
+		{name: "normal priority push", push: &outgoing.PlayerInfo{}, backlogged: true},
+		{name: "dropped low priority push", push: &outgoing.Ping{}, backlogged: true},
+		{name: "coalesced push", push: &outgoing.CharacterStateDelta{}, backlogged: true},
+		{name: "push after the queue caught up", push: &outgoing.PlayerInfo{}, popFirst: true, backlogged: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := newSendQueue(SendQueueConfig{MaxQueued: 2, BacklogTimeout: time.Second})
+			queue.push(&outgoing.LocalCharacterState{})
+			queue.push(&outgoing.LoginQueue{})
+			queue.backlogSince = time.Now().Add(-2 * time.Second)
+
+			if test.popFirst {
+				queue.pop()
+			}
+
+			if backlogged := queue.push(test.push); backlogged != test.backlogged {
+				t.Fatalf("expected backlogged to be %v, got %v", test.backlogged, backlogged)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+)
+
+// StatusClientClosedRequest is the disconnect code used when the connection was lost
+const StatusClientClosedRequest = 499
+
+// DefaultResumeGracePeriod is how long a character stays in the world after the connection was lost
+const DefaultResumeGracePeriod = 60 * time.Second
+
+func newResumeToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// issueResumeToken sends the client a token it can use to resume the session after a short disconnect
+func (c *Client) issueResumeToken() {
+	gracePeriod := c.clientHandler.ResumeGracePeriod
+	if gracePeriod <= 0 || c.HasCapability(CapabilitySessionResume) == false {
+		return
+	}
+
+	token, err := newResumeToken()
+	if err != nil {
+		c.Log.WithError(err).Errorf("Error generating resume token")
+		return
+	}
+
+	c.resumeLock.Lock()
+	c.resumeToken = token
+	c.resumeLock.Unlock()
+
+	c.PacketHandler.WritePacket(&outgoing.SessionResume{Token: token, GracePeriod: int(gracePeriod / time.Second)})
+}
+
+// canResume is true when a lost connection should keep the character in the world
+// resumeLock must be held
+func (c *Client) canResume() bool {
+	return c.Character != nil && len(c.resumeToken) > 0 && c.clientHandler.ResumeGracePeriod > 0
+}
+
+// detach closes the connection but keeps the character in the world
+// until the session is resumed or the grace period is over
+// resumeLock must be held
+func (c *Client) detach() {
+	c.Log.WithField("grace_period", c.clientHandler.ResumeGracePeriod).Infof("Client connection lost, keeping character for resume")
+	c.detached = true
+	c.detachedAt = time.Now()
+	c.PacketHandler.close(websocket.CloseGoingAway, "")
+}
+
+func (c *Client) isDetached() bool {
+	c.resumeLock.Lock()
+	defer c.resumeLock.Unlock()
+
+	return c.detached
+}
+
+// expireDetached disconnects the client if it has been detached for longer than the grace period
+func (c *Client) expireDetached() {
+	c.resumeLock.Lock()
+	if c.detached == false || time.Since(c.detachedAt) < c.clientHandler.ResumeGracePeriod {
+		c.resumeLock.Unlock()
+		return
+	}
+	c.detached = false
+	c.resumeToken = ""
+	c.resumeLock.Unlock()
+
+	c.Log.Infof("Client did not resume the session in time")
+	c.Disconnect(StatusClientClosedRequest, "Client disconnected")
+}
+
+// resume moves the characters of this detached client to the new client
+// false is returned if this client is not detached or the token does not match
+func (c *Client) resume(client *Client, token string) bool {
+	c.resumeLock.Lock()
+	defer c.resumeLock.Unlock()
+
+	if c.detached == false || subtle.ConstantTimeCompare([]byte(token), []byte(c.resumeToken)) != 1 {
+		return false
+	}
+
+	c.detached = false
+	c.resumeToken = ""
+	c.Disconnecting = true
+
+	character := c.Character
+	c.Character = nil
+
+	client.Camera = c.Camera
+	client.Characters = c.Characters
+	for _, ch := range client.Characters {
+		if ch != nil {
+			ch.setClient(client)
+		}
+	}
+
+	// the character stays in the world while the client loads the play scene
+	client.Character = character
+	client.CharacterToLoad = character
+
+	// the new client takes over the slot so the player keeps their id
+	c.clientHandler.replaceClient(c, client)
+
+	c.Log.Infof("Client session resumed by a new connection")
+	c.setDisconnected()
+
+	return true
+}
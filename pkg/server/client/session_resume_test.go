@@ -0,0 +1,59 @@
+package client
+
+import (
+	"testing"
+)
+
+// newSlotTestClient creates a logged in client of the handler in the slot
+func newSlotTestClient(handler *Handler, username string, id int) *Client {
+	client := newQueueTestClient(username)
+	client.clientHandler = handler
+	client.disconnected = make(chan struct{})
+	handler.assignSlot(client, id)
+	return client
+}
+
+func TestResumeKeepsSlotAndCharacter(t *testing.T) {
+	handler := newFullHandler(DefaultLoginQueueSize)
+	existing := newSlotTestClient(handler, "player", 3)
+	character := NewCharacter(0, "hero", existing)
+	existing.Characters = []*Character{character}
+	existing.Character = character
+	existing.resumeToken = "token"
+	existing.detached = true
+
+	client := newQueueTestClient("player")
+	client.clientHandler = handler
+
+	if existing.resume(client, "wrong") {
+		t.Fatalf("expected a wrong token not to resume the session")
+	}
+	if !existing.resume(client, "token") {
+		t.Fatalf("expected the token to resume the session")
+	}
+
+	if client.ID != 3 || handler.clients[3] != client {
+		t.Fatalf("expected the client to get slot 3, got id %d", client.ID)
+	}
+	if client.Character != character || client.CharacterToLoad != character || character.client != client {
+		t.Fatalf("expected the client to get the character of the existing client")
+	}
+	if existing.Character != nil {
+		t.Fatalf("expected the existing client to give up its character")
+	}
+	select {
+	case <-existing.disconnected:
+	default:
+		t.Fatalf("expected the existing client to be disconnected")
+	}
+
+	// removing the old client once its connection is done doesn't free the slot of the new client
+	handler.removeClient(existing)
+	if handler.clients[3] != client {
+		t.Fatalf("expected the client to keep slot 3 after the existing client was removed")
+	}
+
+	if existing.resume(newQueueTestClient("player"), "token") {
+		t.Fatalf("expected the session to only be resumed once")
+	}
+}
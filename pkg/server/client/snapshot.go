@@ -0,0 +1,143 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+)
+
+const (
+	// number of sent snapshots kept to use as a delta baseline
+	snapshotHistory = 32
+
+	// send a full snapshot at least this often (in ticks) even if the client is acknowledging
+	keyframeInterval = 60
+)
+
+type snapshot struct {
+	sequence   int
+	characters map[int]outgoing.CharacterState // keyed by player id
+}
+
+func (s *snapshot) equal(other *snapshot) bool {
+	if len(s.characters) != len(other.characters) {
+		return false
+	}
+	for playerID, character := range s.characters {
+		if otherCharacter, ok := other.characters[playerID]; !ok || otherCharacter != character {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshotTracker keeps the character state snapshots sent to a client
+// so only the changes since the last acknowledged snapshot are sent
+type snapshotTracker struct {
+	lock sync.Mutex
+
+	sequence      int
+	ackedSequence int
+	sinceKeyframe int
+	history       [snapshotHistory]*snapshot
+}
+
+func newSnapshotTracker() *snapshotTracker {
+	return &snapshotTracker{}
+}
+
+// reset forgets all sent snapshots, the next snapshot will be a keyframe
+func (tracker *snapshotTracker) reset() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.ackedSequence = 0
+	tracker.sinceKeyframe = 0
+	tracker.history = [snapshotHistory]*snapshot{}
+}
+
+// ack marks the snapshot as received by the client
+func (tracker *snapshotTracker) ack(sequence int) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if sequence <= tracker.ackedSequence || sequence > tracker.sequence {
+		// old or made up acks are ignored
+		return
+	}
+
+	tracker.ackedSequence = sequence
+}
+
+func (tracker *snapshotTracker) baseline() *snapshot {
+	if tracker.ackedSequence == 0 {
+		return nil
+	}
+
+	base := tracker.history[tracker.ackedSequence%snapshotHistory]
+	if base == nil || base.sequence != tracker.ackedSequence {
+		// the acked snapshot is too old
+		return nil
+	}
+
+	return base
+}
+
+// next builds the packet to send for the current characters
+// nil is returned when nothing changed since the last sent snapshot
+// clients that can't apply deltas always get a keyframe
+func (tracker *snapshotTracker) next(characters []outgoing.CharacterState, deltas bool) outgoing.OutgoingPacket {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	current := &snapshot{characters: make(map[int]outgoing.CharacterState, len(characters))}
+	for _, character := range characters {
+		current.characters[character.PlayerID] = character
+	}
+
+	tracker.sinceKeyframe++
+	base := tracker.baseline()
+	last := tracker.history[tracker.sequence%snapshotHistory]
+
+	if !deltas || base == nil || tracker.sinceKeyframe >= keyframeInterval {
+		tracker.sinceKeyframe = 0
+		tracker.store(current)
+		return &outgoing.LocalCharacterState{
+			Sequence:   current.sequence,
+			Characters: characters,
+		}
+	}
+
+	if last != nil && last.equal(current) {
+		return nil
+	}
+
+	delta := &outgoing.CharacterStateDelta{
+		BaseSequence: base.sequence,
+		Characters:   make([]outgoing.CharacterState, 0),
+		Removed:      make([]int, 0),
+	}
+
+	for _, character := range characters {
+		if old, ok := base.characters[character.PlayerID]; ok && old == character {
+			continue
+		}
+		delta.Characters = append(delta.Characters, character)
+	}
+
+	for playerID := range base.characters {
+		if _, ok := current.characters[playerID]; !ok {
+			delta.Removed = append(delta.Removed, playerID)
+		}
+	}
+
+	tracker.store(current)
+	delta.Sequence = current.sequence
+	return delta
+}
+
+func (tracker *snapshotTracker) store(current *snapshot) {
+	tracker.sequence++
+	current.sequence = tracker.sequence
+	tracker.history[current.sequence%snapshotHistory] = current
+}
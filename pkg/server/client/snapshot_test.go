@@ -0,0 +1,166 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/namelessmmo/realm/pkg/server/packets/outgoing"
+)
+
+func characterAt(playerID int, x int) outgoing.CharacterState {
+	return outgoing.CharacterState{
+		ID:       playerID,
+		PlayerID: playerID,
+		Location: outgoing.CharacterStateLocation{World: "test", X: x},
+	}
+}
+
+// snapshotStep acks a sequence when ack is set, otherwise it sends the characters
+type snapshotStep struct {
+	ack        int
+	characters []outgoing.CharacterState
+	noDeltas   bool
+
+	// expected packet, keyframe or delta, empty when nothing is sent
+	packet       string
+	sequence     int
+	baseSequence int
+	changed      []int // player ids in the delta
+	removed      []int
+}
+
+func TestSnapshotTracker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []snapshotStep
+	}{
+		{
+			name: "snapshots are keyframes until one is acked",
+			steps: []snapshotStep{
+				{characters: []outgoing.CharacterState{characterAt(1, 0)}, packet: "keyframe", sequence: 1},
+				{characters: []outgoing.CharacterState{characterAt(1, 0)}, packet: "keyframe", sequence: 2},
+			},
+		},
+		{
+			name: "deltas only contain changed characters since the acked snapshot",
+			steps: []snapshotStep{
+				{characters: []outgoing.CharacterState{characterAt(1, 0), characterAt(2, 0)}, packet: "keyframe", sequence: 1},
+				{ack: 1},
+				{characters: []outgoing.CharacterState{characterAt(1, 1), characterAt(2, 0)}, packet: "delta", sequence: 2, baseSequence: 1, changed: []int{1}, removed: []int{}},
+				{characters: []outgoing.CharacterState{characterAt(1, 2), characterAt(2, 0)}, packet: "delta", sequence: 3, baseSequence: 1, changed: []int{1}, removed: []int{}},
+			},
+		},
+		{
+			name: "deltas list removed characters",
+			steps: []snapshotStep{
+				{characters: []outgoing.CharacterState{characterAt(1, 0), characterAt(2, 0)}, packet: "keyframe", sequence: 1},
+				{ack: 1},
+				{characters: []outgoing.CharacterState{characterAt(1, 0)}, packet: "delta", sequence: 2, baseSequence: 1, changed: []int{}, removed: []int{2}},
+			},
+		},
+		{
+			name: "nothing is sent when nothing changed since the last snapshot",
+			steps: []snapshotStep{
+				{characters: []outgoing.CharacterState{characterAt(1, 0)}, packet: "keyframe", sequence: 1},
+				{ack: 1},
+				{characters: []outgoing.CharacterState{characterAt(1, 0)}},
+			},
+		},
+		{
+			name: "clients without deltas always get keyframes",
+			steps: []snapshotStep{
+				{characters: []outgoing.CharacterState{characterAt(1, 0)}, noDeltas: true, packet: "keyframe", sequence: 1},
+				{ack: 1},
+				{characters: []outgoing.CharacterState{characterAt(1, 1)}, noDeltas: true, packet: "keyframe", sequence: 2},
+			},
+		},
+		{
+			name: "acks of snapshots that were not sent are ignored",
+			steps: []snapshotStep{
+				{characters: []outgoing.CharacterState{characterAt(1, 0)}, packet: "keyframe", sequence: 1},
+				{ack: 5},
+				{characters: []outgoing.CharacterState{characterAt(1, 1)}, packet: "keyframe", sequence: 2},
+			},
+		},
+		{
+			name: "older acks don't move the baseline back",
+			steps: []snapshotStep{
+				{characters: []outgoing.CharacterState{characterAt(1, 0)}, packet: "keyframe", sequence: 1},
+				{characters: []outgoing.CharacterState{characterAt(1, 1)}, packet: "keyframe", sequence: 2},
+				{ack: 2},
+				{ack: 1},
+				{characters: []outgoing.CharacterState{characterAt(1, 2)}, packet: "delta", sequence: 3, baseSequence: 2, changed: []int{1}, removed: []int{}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newSnapshotTracker()
+			for i, step := range test.steps {
+				if step.ack > 0 {
+					tracker.ack(step.ack)
+					continue
+				}
+
+				checkSnapshot(t, i, step, tracker.next(step.characters, !step.noDeltas))
+			}
+		})
+	}
+}
+
+func checkSnapshot(t *testing.T, i int, step snapshotStep, packet outgoing.OutgoingPacket) {
+	switch packet := packet.(type) {
+	case nil:
+		if len(step.packet) > 0 {
+			t.Fatalf("step %d: expected a %s, got nothing", i, step.packet)
+		}
+	case *outgoing.LocalCharacterState:
+		if step.packet != "keyframe" || packet.Sequence != step.sequence {
+			t.Fatalf("step %d: expected %q %d, got keyframe %d", i, step.packet, step.sequence, packet.Sequence)
+		}
+	case *outgoing.CharacterStateDelta:
+		if step.packet != "delta" || packet.Sequence != step.sequence || packet.BaseSequence != step.baseSequence {
+			t.Fatalf("step %d: expected %q %d based on %d, got delta %d based on %d", i, step.packet, step.sequence, step.baseSequence, packet.Sequence, packet.BaseSequence)
+		}
+		changed := make([]int, 0)
+		for _, character := range packet.Characters {
+			changed = append(changed, character.PlayerID)
+		}
+		if !reflect.DeepEqual(changed, step.changed) || !reflect.DeepEqual(packet.Removed, step.removed) {
+			t.Fatalf("step %d: expected %v changed and %v removed, got %v and %v", i, step.changed, step.removed, changed, packet.Removed)
+		}
+	default:
+		t.Fatalf("step %d: unexpected packet %T", i, packet)
+	}
+}
+
+func TestSnapshotTrackerKeyframes(t *testing.T) {
+	tests := []struct {
+		name      string
+		sends     int
+		ackAll    bool // ack every snapshot instead of only the first
+		keyframes int
+	}{
+		{name: "a keyframe is sent every keyframe interval", sends: keyframeInterval*2 + 1, ackAll: true, keyframes: 3},
+		{name: "acked snapshots older than the history are not used", sends: snapshotHistory + 8, keyframes: 8},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newSnapshotTracker()
+			keyframes := 0
+			for x := 1; x <= test.sends; x++ {
+				if _, ok := tracker.next([]outgoing.CharacterState{characterAt(1, x)}, true).(*outgoing.LocalCharacterState); ok {
+					keyframes++
+				}
+				if x == 1 || test.ackAll {
+					tracker.ack(x)
+				}
+			}
+			if keyframes != test.keyframes {
+				t.Fatalf("expected %d keyframes, got %d", test.keyframes, keyframes)
+			}
+		})
+	}
+}
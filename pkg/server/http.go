@@ -3,10 +3,15 @@ package server
 import (
 	"flag"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/static"
 
+	"github.com/namelessmmo/realm/pkg/server/auth"
 	"github.com/namelessmmo/realm/pkg/server/client"
+	"github.com/namelessmmo/realm/pkg/server/location"
+	"github.com/namelessmmo/realm/pkg/server/store"
 
 	"github.com/gorilla/websocket"
 
@@ -14,6 +19,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// how often the ban file is checked for changes
+const banReloadInterval = 10 * time.Second
+
 type Server struct {
 	upgrader      websocket.Upgrader
 	clientHandler *client.Handler
@@ -30,18 +38,108 @@ func NewServer() *Server {
 
 func (server *Server) Run() {
 	hmacString := flag.String("hmac-auth-string", "", "The HMAC String used to sign auth tokens")
+	hmacKeys := flag.String("hmac-keys", "", "A json file with the HMAC keys used to sign auth tokens, replaces hmac-auth-string")
+	hmacKeysReload := flag.Duration("hmac-keys-reload", time.Minute, "How often the hmac-keys file is checked for changes, 0 disables reloading")
+	publicKeys := flag.String("token-public-keys", "", "A PEM or JWKS file with the public keys that verify RS256 and ES256 auth tokens")
+	publicKeysReload := flag.Duration("token-public-keys-reload", 5*time.Minute, "How often the public key file is checked for changes")
+	devLogin := flag.Bool("dev-login", false, "Allow logging in with only a username, for local development only")
+	banFile := flag.String("ban-file", "", "A json file with the banned usernames and token ids, it is reloaded when it changes")
+	tokenIssuer := flag.String("token-issuer", "", "The iss claim required in auth tokens, empty allows any issuer")
+	tokenAudience := flag.String("token-audience", "", "The aud claim required in auth tokens, empty allows any audience")
+	tokenLeeway := flag.Duration("token-leeway", client.DefaultTokenLeeway, "The clock skew allowed when checking auth token times")
+	duplicateLogin := flag.String("duplicate-login", client.DuplicateLoginReject.String(), "What happens when a player logs in twice, reject the new login or take-over the existing session")
+	compression := flag.Bool("websocket-compression", false, "Negotiate permessage-deflate compression with clients")
+	characterDir := flag.String("character-dir", "characters", "The directory characters are saved in, one json file per account")
+	autosaveInterval := flag.Duration("autosave-interval", client.DefaultAutosaveInterval, "How often characters that changed are saved, 0 disables autosaving")
+	captureDir := flag.String("capture-dir", "captures", "The directory packet captures are written to")
+	captureUsers := flag.String("capture-users", "", "Comma separated usernames to capture packets for")
+	listenAddress := flag.String("listen-address", ":8080", "The address to listen on")
+	tlsCert := flag.String("tls-cert", "", "The TLS certificate file, serves https when set with tls-key")
+	tlsKey := flag.String("tls-key", "", "The TLS private key file")
+	allowedOrigins := flag.String("allowed-origins", "", "Comma separated origins allowed to open websockets, * allows all, the realm's own host is always allowed")
 	flag.Parse()
 
+	server.upgrader.EnableCompression = *compression
+	server.upgrader.CheckOrigin = newOriginChecker(splitList(*allowedOrigins))
+
 	logrus.SetFormatter(&logrus.TextFormatter{
 		DisableColors: true,
 		FullTimestamp: true,
 	})
 
-	if len(*hmacString) == 0 {
-		logrus.Fatalf("hmac-auth-string is required")
+	if len(*hmacString) == 0 && len(*hmacKeys) == 0 && len(*publicKeys) == 0 && !*devLogin {
+		logrus.Fatalf("hmac-auth-string, hmac-keys, token-public-keys or dev-login is required")
+	}
+
+	if len(*hmacString) > 0 && len(*hmacKeys) > 0 {
+		logrus.Fatalf("hmac-auth-string and hmac-keys can't be set together")
+	}
+
+	if (len(*tlsCert) == 0) != (len(*tlsKey) == 0) {
+		logrus.Fatalf("tls-cert and tls-key must be set together")
+	}
+
+	duplicateLoginPolicy, err := client.ParseDuplicateLoginPolicy(*duplicateLogin)
+	if err != nil {
+		logrus.Fatalf("Invalid duplicate-login: %s", err.Error())
+	}
+
+	location.LoadWorlds()
+
+	var hmacKeySet *auth.HMACKeySet
+	if len(*hmacKeys) > 0 {
+		hmacKeySet, err = auth.LoadHMACKeySet(*hmacKeys)
+	} else if len(*hmacString) > 0 {
+		hmacKeySet, err = auth.NewHMACKeySet(&auth.HMACKey{Secret: *hmacString})
+	}
+	if err != nil {
+		logrus.Fatalf("Error loading HMAC keys: %s", err.Error())
+	}
+	if hmacKeySet != nil && *hmacKeysReload > 0 {
+		hmacKeySet.Watch(*hmacKeysReload)
 	}
 
-	server.clientHandler = client.NewClientHandler(*hmacString)
+	characters, err := store.NewFileCharacterStore(*characterDir)
+	if err != nil {
+		logrus.Fatalf("Error opening character store: %s", err.Error())
+	}
+
+	server.clientHandler = client.NewClientHandler(hmacKeySet)
+	server.clientHandler.Characters = characters
+	server.clientHandler.AutosaveInterval = *autosaveInterval
+	if len(*publicKeys) > 0 {
+		keySet, err := auth.LoadKeySet(*publicKeys)
+		if err != nil {
+			logrus.Fatalf("Error loading public keys: %s", err.Error())
+		}
+		if *publicKeysReload > 0 {
+			keySet.Watch(*publicKeysReload)
+		}
+		server.clientHandler.PublicKeys = keySet
+	}
+	if len(*banFile) > 0 {
+		bans, err := auth.LoadFileBanStore(*banFile)
+		if err != nil {
+			logrus.Fatalf("Error loading bans: %s", err.Error())
+		}
+		bans.Watch(banReloadInterval)
+		server.clientHandler.Bans = bans
+	}
+	if *devLogin {
+		logrus.Warnf("Dev logins are enabled, anybody can log in as any player without an access token")
+		server.clientHandler.DevLogin = true
+	}
+	server.clientHandler.DuplicateLoginPolicy = duplicateLoginPolicy
+	server.clientHandler.TokenValidation = client.TokenValidation{
+		Issuer:   *tokenIssuer,
+		Audience: *tokenAudience,
+		Leeway:   *tokenLeeway,
+	}
+	server.clientHandler.CaptureDir = *captureDir
+	server.clientHandler.CaptureUsernames = make(map[string]bool)
+	for _, username := range splitList(*captureUsers) {
+		server.clientHandler.CaptureUsernames[username] = true
+	}
 	server.clientHandler.Run()
 
 	r := gin.Default()
@@ -52,7 +150,14 @@ func (server *Server) Run() {
 		server.handleWebSocket(context)
 	})
 
-	_ = r.Run() // listen and serve on 0.0.0.0:8080
+	if len(*tlsCert) > 0 {
+		err = r.RunTLS(*listenAddress, *tlsCert, *tlsKey)
+	} else {
+		err = r.Run(*listenAddress)
+	}
+	if err != nil {
+		logrus.Fatalf("Error running server: %s", err.Error())
+	}
 }
 
 func (server *Server) handleWebSocket(context *gin.Context) {
@@ -63,3 +168,15 @@ func (server *Server) handleWebSocket(context *gin.Context) {
 		context.String(http.StatusInternalServerError, "Error connecting websocket: %s", err.Error())
 	}
 }
+
+// splitList splits a comma separated flag value
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -15,6 +15,11 @@ var WorldHandler *handler
 
 func init() {
 	WorldHandler = &handler{worlds: make(map[string]*World)}
+}
+
+// LoadWorlds loads the worlds from the tilemaps in the public directory
+// it must be called before any world is used
+func LoadWorlds() {
 	WorldHandler.loadWorlds()
 }
 
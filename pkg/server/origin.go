@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// newOriginChecker allows websocket connections from the allowed origins
+// "*" allows any origin, requests from the same host are always allowed
+func newOriginChecker(allowedOrigins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool)
+	for _, origin := range allowedOrigins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if len(origin) == 0 {
+			// not sent by a browser
+			return true
+		}
+
+		if allowed["*"] || allowed[strings.ToLower(origin)] {
+			return true
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		return strings.EqualFold(u.Host, r.Host)
+	}
+}
@@ -0,0 +1,8 @@
+package outgoing
+
+// LoginQueue is sent to a player waiting for a free slot when the realm is full
+// it is sent again every time the queue changes
+type LoginQueue struct {
+	Position int `json:"position"` // 1 is admitted next
+	Length   int `json:"length"`
+}
@@ -1,4 +1,7 @@
 package outgoing
 
+// Ping is answered by the client with a Pong carrying the same id and timestamp
 type Ping struct {
+	ID        int   `json:"id"`
+	Timestamp int64 `json:"timestamp"` // unix milliseconds on the server
 }
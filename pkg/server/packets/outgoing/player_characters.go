@@ -1,8 +1,12 @@
 package outgoing
 
+// PlayerCharacter is the summary of a character shown on character selection
 type PlayerCharacter struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	World      string `json:"world"`
+	LastPlayed int64  `json:"last_played"` // unix seconds, 0 if never played
+	Level      int    `json:"level,omitempty"`
 }
 
 type PlayerCharacters struct {
@@ -2,4 +2,8 @@ package outgoing
 
 type PlayerInfo struct {
 	PlayerID int `json:"player_id"`
+
+	// smoothed round trip time and jitter in milliseconds, 0 until measured
+	RTT    int `json:"rtt"`
+	Jitter int `json:"jitter"`
 }
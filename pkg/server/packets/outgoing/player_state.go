@@ -12,6 +12,17 @@ type CharacterState struct {
 	Location CharacterStateLocation `json:"location"`
 }
 
+// LocalCharacterState is a full snapshot (keyframe) of the characters around the player
 type LocalCharacterState struct {
+	Sequence   int              `json:"sequence"`
 	Characters []CharacterState `json:"characters"`
 }
+
+// CharacterStateDelta is the difference between the snapshot BaseSequence and Sequence
+// Characters entered or changed, Removed are the player ids of characters that left
+type CharacterStateDelta struct {
+	Sequence     int              `json:"sequence"`
+	BaseSequence int              `json:"base_sequence"`
+	Characters   []CharacterState `json:"characters"`
+	Removed      []int            `json:"removed"`
+}
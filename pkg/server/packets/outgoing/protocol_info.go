@@ -0,0 +1,6 @@
+package outgoing
+
+type ProtocolInfo struct {
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities"`
+}
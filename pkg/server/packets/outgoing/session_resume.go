@@ -0,0 +1,7 @@
+package outgoing
+
+// SessionResume is the token the client sends in PlayerLogin to resume the session after a short disconnect
+type SessionResume struct {
+	Token       string `json:"token"`
+	GracePeriod int    `json:"grace_period"` // seconds
+}
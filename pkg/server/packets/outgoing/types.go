@@ -3,3 +3,19 @@ package outgoing
 type OutgoingPacket interface {
 	// TODO: what methods do we need on a packet?
 }
+
+// Packets are all the packets the realm sends
+// add new packets here so they are included in the generated client definitions, a test fails when one is missing
+var Packets = []OutgoingPacket{
+	&CharacterLoading{},
+	&CharacterStateDelta{},
+	&LocalCharacterState{},
+	&LoginQueue{},
+	&Ping{},
+	&PlayerCharacters{},
+	&PlayerDisconnect{},
+	&PlayerInfo{},
+	&ProtocolInfo{},
+	&SessionResume{},
+	&WorldData{},
+}
@@ -0,0 +1,73 @@
+package outgoing
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// nestedTypes returns the names of the package types used in fields of the struct
+func nestedTypes(expr ast.Expr, names map[string]bool) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		names[expr.Name] = true
+	case *ast.StarExpr:
+		nestedTypes(expr.X, names)
+	case *ast.ArrayType:
+		nestedTypes(expr.Elt, names)
+	case *ast.MapType:
+		nestedTypes(expr.Key, names)
+		nestedTypes(expr.Value, names)
+	}
+}
+
+// every exported struct that is not part of another packet is a packet and must be in Packets
+func TestPacketsListsEveryPacket(t *testing.T) {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", nil, 0)
+	if err != nil {
+		t.Fatalf("Error parsing package: %s", err.Error())
+	}
+
+	structs := make([]string, 0)
+	nested := make(map[string]bool)
+	for _, file := range pkgs["outgoing"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok || !typeSpec.Name.IsExported() {
+					continue
+				}
+				structs = append(structs, typeSpec.Name.Name)
+				for _, field := range structType.Fields.List {
+					nestedTypes(field.Type, nested)
+				}
+			}
+		}
+	}
+
+	expected := make([]string, 0)
+	for _, name := range structs {
+		if !nested[name] {
+			expected = append(expected, name)
+		}
+	}
+	sort.Strings(expected)
+
+	listed := make([]string, 0, len(Packets))
+	for _, packet := range Packets {
+		listed = append(listed, reflect.TypeOf(packet).Elem().Name())
+	}
+	sort.Strings(listed)
+
+	if !reflect.DeepEqual(listed, expected) {
+		t.Fatalf("Packets lists %v but the package has the packets %v", listed, expected)
+	}
+}
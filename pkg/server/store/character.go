@@ -0,0 +1,40 @@
+package store
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCharacterNotFound is returned when the account has no character with the id
+var ErrCharacterNotFound = errors.New("Character not found")
+
+// CharacterData is everything saved for a character
+type CharacterData struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+
+	World string `json:"world"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+
+	LastPlayed time.Time `json:"last_played"`
+
+	// Level is 0 until characters have levels
+	Level int `json:"level,omitempty"`
+}
+
+// CharacterStore saves the characters of each account
+type CharacterStore interface {
+	// ListCharacters returns all characters of the account sorted by id
+	ListCharacters(username string) ([]*CharacterData, error)
+
+	// LoadCharacter returns ErrCharacterNotFound if the account has no character with the id
+	LoadCharacter(username string, id int) (*CharacterData, error)
+
+	// SaveCharacter creates or replaces the character with the same id
+	SaveCharacter(username string, character *CharacterData) error
+
+	// DeleteCharacter does nothing if the account has no character with the id
+	DeleteCharacter(username string, id int) error
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FileCharacterStore keeps the characters of each account in a json file in a directory
+type FileCharacterStore struct {
+	dir string
+
+	lock sync.Mutex
+}
+
+type accountFile struct {
+	Characters []*CharacterData `json:"characters"`
+}
+
+// NewFileCharacterStore creates the directory if it doesn't exist
+func NewFileCharacterStore(dir string) (*FileCharacterStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating character directory")
+	}
+	return &FileCharacterStore{dir: dir}, nil
+}
+
+func (store *FileCharacterStore) ListCharacters(username string) ([]*CharacterData, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	account, err := store.read(username)
+	if err != nil {
+		return nil, err
+	}
+	return account.Characters, nil
+}
+
+func (store *FileCharacterStore) LoadCharacter(username string, id int) (*CharacterData, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	account, err := store.read(username)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, character := range account.Characters {
+		if character.ID == id {
+			return character, nil
+		}
+	}
+	return nil, ErrCharacterNotFound
+}
+
+func (store *FileCharacterStore) SaveCharacter(username string, character *CharacterData) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	account, err := store.read(username)
+	if err != nil {
+		return err
+	}
+
+	saved := *character
+	replaced := false
+	for i, existing := range account.Characters {
+		if existing.ID == character.ID {
+			account.Characters[i] = &saved
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		account.Characters = append(account.Characters, &saved)
+	}
+
+	return store.write(username, account)
+}
+
+func (store *FileCharacterStore) DeleteCharacter(username string, id int) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	account, err := store.read(username)
+	if err != nil {
+		return err
+	}
+
+	for i, existing := range account.Characters {
+		if existing.ID == id {
+			account.Characters = append(account.Characters[:i], account.Characters[i+1:]...)
+			return store.write(username, account)
+		}
+	}
+	return nil
+}
+
+// path escapes the username so it can't leave the directory
+func (store *FileCharacterStore) path(username string) string {
+	return filepath.Join(store.dir, url.PathEscape(username)+".json")
+}
+
+// read returns an empty account if the file doesn't exist yet
+func (store *FileCharacterStore) read(username string) (*accountFile, error) {
+	account := &accountFile{Characters: make([]*CharacterData, 0)}
+
+	data, err := ioutil.ReadFile(store.path(username))
+	if os.IsNotExist(err) {
+		return account, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading account file")
+	}
+
+	err = json.Unmarshal(data, account)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing account file %s", store.path(username))
+	}
+
+	sort.Slice(account.Characters, func(i, j int) bool {
+		return account.Characters[i].ID < account.Characters[j].ID
+	})
+	return account, nil
+}
+
+// write replaces the account file through a temporary file so a crash can't leave half a file
+func (store *FileCharacterStore) write(username string, account *accountFile) error {
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error marshaling account file")
+	}
+
+	file, err := ioutil.TempFile(store.dir, ".account-")
+	if err != nil {
+		return errors.Wrap(err, "Error creating account file")
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error writing account file")
+	}
+
+	err = os.Rename(file.Name(), store.path(username))
+	if err != nil {
+		return errors.Wrap(err, "Error replacing account file")
+	}
+	return nil
+}
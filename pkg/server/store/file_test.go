@@ -0,0 +1,171 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestFileStore(t *testing.T) (*FileCharacterStore, string) {
+	dir, err := ioutil.TempDir("", "characters")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err.Error())
+	}
+
+	store, err := NewFileCharacterStore(dir)
+	if err != nil {
+		t.Fatalf("Error creating store: %s", err.Error())
+	}
+	return store, dir
+}
+
+func TestFileCharacterStoreRoundTrip(t *testing.T) {
+	lastPlayed := time.Date(2019, 4, 1, 12, 30, 0, 0, time.UTC)
+	first := &CharacterData{ID: 0, Name: "first", World: "untitled", X: 3, Y: 4, LastPlayed: lastPlayed, Level: 2}
+	second := &CharacterData{ID: 1, Name: "second", World: "untitled"}
+	moved := &CharacterData{ID: 0, Name: "first", World: "other", X: 10, Y: 20, LastPlayed: lastPlayed.Add(time.Hour), Level: 3}
+
+	tests := []struct {
+		name     string
+		username string
+		save     []*CharacterData
+		delete   []int
+		expected []*CharacterData
+	}{
+		{name: "new account has no characters", username: "player", expected: []*CharacterData{}},
+		{name: "saved characters are listed by id", username: "player", save: []*CharacterData{second, first}, expected: []*CharacterData{first, second}},
+		{name: "saving a character replaces it", username: "player", save: []*CharacterData{first, second, moved}, expected: []*CharacterData{moved, second}},
+		{name: "deleted characters are removed", username: "player", save: []*CharacterData{first, second}, delete: []int{0}, expected: []*CharacterData{second}},
+		{name: "deleting a missing character does nothing", username: "player", save: []*CharacterData{first}, delete: []int{5}, expected: []*CharacterData{first}},
+		{name: "usernames are escaped", username: "../other/player", save: []*CharacterData{first}, expected: []*CharacterData{first}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, dir := newTestFileStore(t)
+			defer os.RemoveAll(dir)
+
+			for _, character := range test.save {
+				err := store.SaveCharacter(test.username, character)
+				if err != nil {
+					t.Fatalf("Error saving character: %s", err.Error())
+				}
+			}
+			for _, id := range test.delete {
+				err := store.DeleteCharacter(test.username, id)
+				if err != nil {
+					t.Fatalf("Error deleting character: %s", err.Error())
+				}
+			}
+
+			// a new store reads everything back from the files
+			store, err := NewFileCharacterStore(dir)
+			if err != nil {
+				t.Fatalf("Error opening store: %s", err.Error())
+			}
+
+			characters, err := store.ListCharacters(test.username)
+			if err != nil {
+				t.Fatalf("Error listing characters: %s", err.Error())
+			}
+			if !reflect.DeepEqual(characters, test.expected) {
+				t.Fatalf("expected characters %+v, got %+v", test.expected, characters)
+			}
+
+			for _, expected := range test.expected {
+				character, err := store.LoadCharacter(test.username, expected.ID)
+				if err != nil || !reflect.DeepEqual(character, expected) {
+					t.Fatalf("expected to load %+v, got %+v %v", expected, character, err)
+				}
+			}
+			if _, err := store.LoadCharacter(test.username, 100); err != ErrCharacterNotFound {
+				t.Fatalf("expected ErrCharacterNotFound, got %v", err)
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("Error reading dir: %s", err.Error())
+			}
+			for _, file := range files {
+				if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+					t.Fatalf("unexpected file %s in the character directory", file.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestFileCharacterStoreAtomicWrite(t *testing.T) {
+	store, dir := newTestFileStore(t)
+	defer os.RemoveAll(dir)
+
+	err := store.SaveCharacter("player", &CharacterData{ID: 0, Name: "player"})
+	if err != nil {
+		t.Fatalf("Error saving character: %s", err.Error())
+	}
+
+	// readers never see a partially written file
+	done := make(chan struct{})
+	wait := sync.WaitGroup{}
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for x := 1; x <= 200; x++ {
+			err := store.SaveCharacter("player", &CharacterData{ID: 0, Name: strings.Repeat("player", x), X: x})
+			if err != nil {
+				t.Errorf("Error saving character: %s", err.Error())
+				break
+			}
+		}
+		close(done)
+	}()
+
+	path := store.path("player")
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Error reading account file: %s", err.Error())
+		}
+		account := &accountFile{}
+		if err := json.Unmarshal(data, account); err != nil || len(account.Characters) != 1 {
+			t.Fatalf("read a partially written account file: %s", string(data))
+		}
+	}
+	wait.Wait()
+
+	// failed writes leave no temporary files behind
+	blocked := store.path("blocked")
+	err = os.Mkdir(blocked, 0755)
+	if err != nil {
+		t.Fatalf("Error creating dir: %s", err.Error())
+	}
+	err = ioutil.WriteFile(filepath.Join(blocked, "file"), []byte{}, 0644)
+	if err != nil {
+		t.Fatalf("Error creating file: %s", err.Error())
+	}
+	if err := store.write("blocked", &accountFile{}); err == nil {
+		t.Fatalf("expected an error replacing a directory")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Error reading dir: %s", err.Error())
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".account-") {
+			t.Fatalf("temporary file %s was left behind", file.Name())
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/namelessmmo/realm/pkg/server/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// RunTokenCommand mints an access token for local development and integration tests
+//
+//	realm token --hmac-auth-string=localdev --username=bob --roles=admin --expiry=24h
+func RunTokenCommand(args []string) {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	hmacString := flags.String("hmac-auth-string", "", "The HMAC String used to sign auth tokens")
+	hmacKeys := flags.String("hmac-keys", "", "A json file with the HMAC keys, the first key that is not verify-only signs the token")
+	username := flags.String("username", "", "The username the token is for")
+	roles := flags.String("roles", "", "Comma separated roles of the player")
+	expiry := flags.Duration("expiry", 24*time.Hour, "How long the token is valid for")
+	issuer := flags.String("token-issuer", "", "The iss claim of the token")
+	audience := flags.String("token-audience", "", "The aud claim of the token")
+	_ = flags.Parse(args)
+
+	if len(*username) == 0 {
+		logrus.Fatalf("username is required")
+	}
+
+	var keySet *auth.HMACKeySet
+	var err error
+	if len(*hmacKeys) > 0 {
+		keySet, err = auth.LoadHMACKeySet(*hmacKeys)
+	} else if len(*hmacString) > 0 {
+		keySet, err = auth.NewHMACKeySet(&auth.HMACKey{Secret: *hmacString})
+	} else {
+		logrus.Fatalf("hmac-auth-string or hmac-keys is required")
+	}
+	if err != nil {
+		logrus.Fatalf("Error loading HMAC keys: %s", err.Error())
+	}
+
+	key, ok := keySet.SigningKey()
+	if !ok {
+		logrus.Fatalf("All HMAC keys are verify-only")
+	}
+
+	claims, err := auth.NewClaims(*username, splitList(*roles), *expiry)
+	if err != nil {
+		logrus.Fatalf("Error creating claims: %s", err.Error())
+	}
+	claims.Issuer = *issuer
+	if len(*audience) > 0 {
+		claims.Audience = auth.Audience{*audience}
+	}
+
+	token, err := auth.MintToken(key, claims)
+	if err != nil {
+		logrus.Fatalf("Error minting token: %s", err.Error())
+	}
+
+	fmt.Fprintln(os.Stdout, token)
+}
@@ -1,6 +1,22 @@
 import * as Cookies from "js-cookie";
 import * as PIXI from "pixi.js";
 import { SceneManager } from "./engine/scene_manager";
+import {
+    ClientPacketCode,
+    LoginQueue,
+    Ping,
+    PlayerDisconnect,
+    PlayerInfo,
+    PlayerLogin,
+    Pong,
+    ProtocolInfo,
+    RealmPacketCode,
+    SessionResume,
+} from "./packets";
+
+// must match the realm protocol version, bump it when packets change
+const protocolVersion = 1;
+const capabilities = ["delta_state", "session_resume", "batch"];
 
 export class Client {
 
@@ -100,6 +116,13 @@ export class Client {
         // stop the shared ticker
         PIXI.ticker.shared.stop();
 
+        // realms started with --dev-login accept a plain username
+        const devUsername = new URLSearchParams(window.location.search).get("dev_username");
+        if (devUsername) {
+            this.connect("", devUsername);
+            return;
+        }
+
         // load auth cookie
         const cookie = Cookies.get("namelessmmo_auth-session");
 
@@ -124,7 +147,7 @@ export class Client {
         this.connect(accessToken);
     }
 
-    private connect(accessToken: string) {
+    private connect(accessToken: string, username: string = "") {
         this.sceneManager.loadScene.setMessage(0, "Connecting...");
         const loc = window.location;
         let newUri;
@@ -141,15 +164,22 @@ export class Client {
             // send login info
             that.sceneManager.socket = that.socket;
             that.sceneManager.loadScene.setMessage(200, "Logging in...");
-            const loginData = JSON.stringify({
-                code: "PlayerLogin",
-                data: {
-                    access_token: accessToken,
-                    screen: {
-                        height: that.application.renderer.height,
-                        width: that.application.renderer.width,
-                    },
+            const playerLogin: PlayerLogin = {
+                access_token: accessToken,
+                capabilities,
+                // the realm defaults to json, which is what we parse
+                codec: "json",
+                protocol_version: protocolVersion,
+                resume_token: sessionStorage.getItem("namelessmmo_resume-token") || "",
+                screen: {
+                    height: that.application.renderer.height,
+                    width: that.application.renderer.width,
                 },
+                username,
+            };
+            const loginData = JSON.stringify({
+                code: ClientPacketCode.PlayerLogin,
+                data: playerLogin,
             });
             that.socket.send(loginData);
         };
@@ -161,20 +191,56 @@ export class Client {
         };
         this.socket.onmessage = (evt) => {
             const evtData = JSON.parse(evt.data);
-            const code = evtData.code;
-            const data = evtData.data;
-            that.processIncomingPackets(code, data);
+            // the realm may send several packets in one message
+            const packets = Array.isArray(evtData) ? evtData : [evtData];
+            for (const packet of packets) {
+                that.processIncomingPackets(packet.code, packet.data);
+            }
         };
     }
 
     private processIncomingPackets(code: string, data: any) {
         switch (code) {
-            case "Ping":
-                // This should rarely if ever be used due to other packets being constantly sent
-                // TODO: do we need to send a pong back?
+            case RealmPacketCode.Ping:
+                // echo the ping back so the realm can measure our latency
+                const ping = data as Ping;
+                const pong: Pong = {
+                    id: ping.id,
+                    timestamp: ping.timestamp,
+                };
+                this.socket.send(JSON.stringify({
+                    code: ClientPacketCode.Pong,
+                    data: pong,
+                }));
+                break;
+            case RealmPacketCode.PlayerInfo:
+                // player info is sent again every time our latency is measured
+                const playerInfo = data as PlayerInfo;
+                this.sceneManager.rtt = playerInfo.rtt;
+                this.sceneManager.jitter = playerInfo.jitter;
+                if (this.sceneManager.playerID === undefined) {
+                    this.sceneManager.playerID = playerInfo.player_id;
+                    this.sceneManager.processPackets(code, data);
+                }
+                break;
+            case RealmPacketCode.ProtocolInfo:
+                const protocolInfo = data as ProtocolInfo;
+                console.log(`Realm protocol ${protocolInfo.version}`, protocolInfo.capabilities);
+                break;
+            case RealmPacketCode.SessionResume:
+                // lets us get back into the game if the connection drops
+                const sessionResume = data as SessionResume;
+                sessionStorage.setItem("namelessmmo_resume-token", sessionResume.token);
+                break;
+            case RealmPacketCode.LoginQueue:
+                const loginQueue = data as LoginQueue;
+                this.sceneManager.loadScene.setMessage(0,
+                    `The realm is full, you are ${loginQueue.position} of ${loginQueue.length} in the queue`);
                 break;
-            case "PlayerDisconnect":
-                this.sceneManager.loadScene.setMessage(data.code, data.message);
+            case RealmPacketCode.PlayerDisconnect:
+                const disconnect = data as PlayerDisconnect;
+                sessionStorage.removeItem("namelessmmo_resume-token");
+                this.sceneManager.loadScene.setMessage(disconnect.code, disconnect.message);
                 this.sceneManager.setScene(null);
                 break;
             default:
@@ -1,5 +1,6 @@
 import * as Handlebars from "handlebars/dist/cjs/handlebars";
 import * as $ from "jquery";
+import { ClientPacketCode, InterfaceButtonClick } from "../packets";
 import { Scene } from "./scene";
 
 export class Interface {
@@ -46,12 +47,13 @@ export class Interface {
         }
 
         if (this.clickedButtonID !== -1) {
+            const buttonClick: InterfaceButtonClick = {
+                button_id: this.clickedButtonID,
+                interface_id: this.id,
+            };
             const clickedButtonData = JSON.stringify({
-                code: "InterfaceButtonClick",
-                data: {
-                    button_id: this.clickedButtonID,
-                    interface_id: this.id,
-                },
+                code: ClientPacketCode.InterfaceButtonClick,
+                data: buttonClick,
             });
             this.scene.getSocket().send(clickedButtonData);
 
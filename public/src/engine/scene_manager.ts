@@ -6,6 +6,12 @@ import { Load } from "./scenes/load";
 export class SceneManager {
 
     public socket: WebSocket;
+
+    // latency to the realm in milliseconds
+    public rtt: number;
+    public jitter: number;
+
+    public playerID: number;
     public readonly loadScene: Load;
     private readonly stage: PIXI.Container;
 
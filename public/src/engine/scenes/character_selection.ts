@@ -1,3 +1,4 @@
+import { PlayerCharacters, RealmPacketCode } from "../../packets";
 import { Interface } from "../interface";
 import { Scene } from "../scene";
 import { Play } from "./play";
@@ -38,19 +39,28 @@ export class CharacterSelection extends Scene {
 
     public processPackets(code: string, data: any) {
         switch (code) {
-            case "PlayerCharacters":
-                for (let i = 0; i < data.characters.length; i++) {
-                    if (data.characters[i] == null) {
+            case RealmPacketCode.PlayerCharacters:
+                const playerCharacters = data as PlayerCharacters;
+                for (let i = 0; i < playerCharacters.characters.length; i++) {
+                    const character = playerCharacters.characters[i];
+                    if (character == null) {
                         this.characters[i] = null;
                         continue;
                     }
-                    this.characters[i] = {characterID: data.characters[i].id};
+                    this.characters[i] = {
+                        characterID: character.id,
+                        lastPlayed: character.last_played > 0 ?
+                            new Date(character.last_played * 1000).toLocaleDateString() : "Never",
+                        level: character.level,
+                        name: character.name,
+                        world: character.world,
+                    };
                 }
                 if (this.selectionInterface !== undefined) {
                     this.selectionInterface.data = {characters: this.characters};
                 }
                 break;
-            case "CharacterLoading":
+            case RealmPacketCode.CharacterLoading:
                 this.sceneManager.loadScene.setMessage(0, "Loading Game...");
                 this.sceneManager.setScene(new Play(this.playerID));
                 break;
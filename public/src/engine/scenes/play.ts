@@ -4,6 +4,17 @@ import { Keyboard } from "../../game/keyboard";
 import { Location } from "../../game/location";
 import { Movement } from "../../game/movement";
 import { World } from "../../game/world";
+import {
+    CharacterMove,
+    CharacterState,
+    CharacterStateAck,
+    CharacterStateDelta,
+    ClientPacketCode,
+    DoneLoading,
+    LocalCharacterState,
+    RealmPacketCode,
+    WorldData,
+} from "../../packets";
 import { Scene } from "../scene";
 
 export class Play extends Scene {
@@ -13,6 +24,7 @@ export class Play extends Scene {
     private world: World;
     private renderedWorld: World;
     private localCharacters: Map<number, Character>;
+    private snapshots: Map<number, Map<number, CharacterState>>;
     private camera: Camera;
     private movement: Movement;
 
@@ -21,6 +33,7 @@ export class Play extends Scene {
 
         this.playerID = playerID;
         this.localCharacters = new Map();
+        this.snapshots = new Map();
     }
 
     public _load(cb: () => void): void {
@@ -37,38 +50,35 @@ export class Play extends Scene {
 
     public processPackets(code: string, data: any): void {
         switch (code) {
-            case "WorldData":
-                this.world = new World(data.name, data.tilemap, this.loader);
+            case RealmPacketCode.WorldData:
+                const worldData = data as WorldData;
+                this.world = new World(worldData.name, worldData.tilemap, this.loader);
                 this.world.load();
                 break;
-            case "LocalCharacterState":
-                const dataCharacters = data.characters;
-                const dataCharacterIDs = [];
-                for (const dataCharacter of dataCharacters) {
-                    const dataCharacterLocation = dataCharacter.location;
-                    dataCharacterIDs.push(dataCharacter.player_id);
-
-                    if (this.localCharacters.has(dataCharacter.player_id)) {
-                        const character = this.localCharacters.get(dataCharacter.player_id);
-                        character.location = new Location(dataCharacterLocation.x, dataCharacterLocation.y, this.world);
-
-                        this.localCharacters.set(character.playerID, character);
-                    } else {
-                        const character = new Character(dataCharacter.player_id, dataCharacter.id);
-                        character.location = new Location(dataCharacterLocation.x, dataCharacterLocation.y, this.world);
-                        this.localCharacters.set(character.playerID, character);
-                    }
+            case RealmPacketCode.LocalCharacterState:
+                // a full snapshot of the characters around us
+                const state = data as LocalCharacterState;
+                const keyframe = new Map<number, CharacterState>();
+                for (const dataCharacter of state.characters) {
+                    keyframe.set(dataCharacter.player_id, dataCharacter);
                 }
-
-                for (const pid of this.localCharacters.keys()) {
-                    if (!dataCharacterIDs.includes(pid)) {
-                        const character = this.localCharacters.get(pid);
-                        character.unRender(this);
-                        this.localCharacters.delete(character.playerID);
-                    }
+                this.applySnapshot(state.sequence, keyframe);
+                break;
+            case RealmPacketCode.CharacterStateDelta:
+                // the changes since a snapshot we acknowledged
+                const delta = data as CharacterStateDelta;
+                if (this.snapshots.has(delta.base_sequence) === false) {
+                    // we don't know the baseline, wait for the next keyframe
+                    break;
                 }
-
-                this.setLoaded();
+                const snapshot = new Map(this.snapshots.get(delta.base_sequence));
+                for (const dataCharacter of delta.characters) {
+                    snapshot.set(dataCharacter.player_id, dataCharacter);
+                }
+                for (const pid of delta.removed) {
+                    snapshot.delete(pid);
+                }
+                this.applySnapshot(delta.sequence, snapshot);
                 break;
             default:
                 console.log(`Unknown packet ${code} for scene ${this.name}`);
@@ -86,14 +96,15 @@ export class Play extends Scene {
         const myCharacterWorld = myCharacterLocation.world;
 
         if (this.movement.isMoving()) {
+            const move: CharacterMove = {
+                down: this.movement.down,
+                left: this.movement.left,
+                right: this.movement.right,
+                up: this.movement.up,
+            };
             this.socket.send(JSON.stringify({
-                code: "CharacterMove",
-                data: {
-                    down: this.movement.down,
-                    left: this.movement.left,
-                    right: this.movement.right,
-                    up: this.movement.up,
-                },
+                code: ClientPacketCode.CharacterMove,
+                data: move,
             }));
 
             // We are "predicting" the local character location in case there is lag
@@ -170,14 +181,58 @@ export class Play extends Scene {
     protected setup(): void {
         this.movement = new Movement();
         this.setupGameKeyboard();
+        const doneLoading: DoneLoading = {
+            what: this.name,
+        };
         this.socket.send(JSON.stringify({
-            code: "DoneLoading",
-            data: {
-                what: this.name,
-            },
+            code: ClientPacketCode.DoneLoading,
+            data: doneLoading,
         }));
     }
 
+    private applySnapshot(sequence: number, snapshot: Map<number, CharacterState>) {
+        // keep a few snapshots around so deltas can be applied to them
+        this.snapshots.set(sequence, snapshot);
+        for (const oldSequence of Array.from(this.snapshots.keys())) {
+            if (oldSequence <= sequence - 32) {
+                this.snapshots.delete(oldSequence);
+            }
+        }
+
+        for (const dataCharacter of Array.from(snapshot.values())) {
+            const dataCharacterLocation = dataCharacter.location;
+
+            if (this.localCharacters.has(dataCharacter.player_id)) {
+                const character = this.localCharacters.get(dataCharacter.player_id);
+                character.location = new Location(dataCharacterLocation.x, dataCharacterLocation.y, this.world);
+
+                this.localCharacters.set(character.playerID, character);
+            } else {
+                const character = new Character(dataCharacter.player_id, dataCharacter.id);
+                character.location = new Location(dataCharacterLocation.x, dataCharacterLocation.y, this.world);
+                this.localCharacters.set(character.playerID, character);
+            }
+        }
+
+        for (const pid of Array.from(this.localCharacters.keys())) {
+            if (!snapshot.has(pid)) {
+                const character = this.localCharacters.get(pid);
+                character.unRender(this);
+                this.localCharacters.delete(character.playerID);
+            }
+        }
+
+        const ack: CharacterStateAck = {
+            sequence,
+        };
+        this.socket.send(JSON.stringify({
+            code: ClientPacketCode.CharacterStateAck,
+            data: ack,
+        }));
+
+        this.setLoaded();
+    }
+
     private setupGameKeyboard() { // This will get giant when we add more keybinds so we may want to change this
         // don't send packets here directly
         // just set variables to do that thing
@@ -0,0 +1,170 @@
+// Code generated by packetgen. DO NOT EDIT.
+// Run "go generate" in the repository root after changing packets.
+/* tslint:disable */
+
+export enum RealmPacketCode {
+    CharacterLoading = "CharacterLoading",
+    CharacterStateDelta = "CharacterStateDelta",
+    LocalCharacterState = "LocalCharacterState",
+    LoginQueue = "LoginQueue",
+    Ping = "Ping",
+    PlayerCharacters = "PlayerCharacters",
+    PlayerDisconnect = "PlayerDisconnect",
+    PlayerInfo = "PlayerInfo",
+    ProtocolInfo = "ProtocolInfo",
+    SessionResume = "SessionResume",
+    WorldData = "WorldData",
+}
+
+export enum ClientPacketCode {
+    CharacterMove = "CharacterMove",
+    CharacterStateAck = "CharacterStateAck",
+    DoneLoading = "DoneLoading",
+    InterfaceButtonClick = "InterfaceButtonClick",
+    KickPlayer = "KickPlayer",
+    PlayerLogin = "PlayerLogin",
+    Pong = "Pong",
+}
+
+export interface CharacterLoading {
+    character_id: number;
+}
+
+export interface CharacterMove {
+    up: boolean;
+    down: boolean;
+    left: boolean;
+    right: boolean;
+}
+
+export interface CharacterState {
+    id: number;
+    player_id: number;
+    location: CharacterStateLocation;
+}
+
+export interface CharacterStateAck {
+    sequence: number;
+}
+
+export interface CharacterStateDelta {
+    sequence: number;
+    base_sequence: number;
+    characters: CharacterState[];
+    removed: number[];
+}
+
+export interface CharacterStateLocation {
+    world: string;
+    x: number;
+    y: number;
+}
+
+export interface DoneLoading {
+    what: string;
+}
+
+export interface InterfaceButtonClick {
+    interface_id: number;
+    button_id: number;
+}
+
+export interface KickPlayer {
+    username: string;
+    message: string;
+}
+
+export interface LocalCharacterState {
+    sequence: number;
+    characters: CharacterState[];
+}
+
+export interface LoginQueue {
+    position: number;
+    length: number;
+}
+
+export interface Ping {
+    id: number;
+    timestamp: number;
+}
+
+export interface PlayerCharacter {
+    id: number;
+    name: string;
+    world: string;
+    last_played: number;
+    level?: number;
+}
+
+export interface PlayerCharacters {
+    characters: (PlayerCharacter | null)[];
+}
+
+export interface PlayerDisconnect {
+    code: number;
+    message: string;
+}
+
+export interface PlayerInfo {
+    player_id: number;
+    rtt: number;
+    jitter: number;
+}
+
+export interface PlayerLogin {
+    protocol_version: number;
+    capabilities: string[];
+    access_token: string;
+    username: string;
+    codec: string;
+    resume_token: string;
+    screen: {
+        width: number;
+        height: number;
+    };
+}
+
+export interface Pong {
+    id: number;
+    timestamp: number;
+}
+
+export interface ProtocolInfo {
+    version: number;
+    capabilities: string[];
+}
+
+export interface SessionResume {
+    token: string;
+    grace_period: number;
+}
+
+export interface Tilemap {
+    height: number;
+    width: number;
+    properties: {
+        name: string;
+        type: string;
+        value: any;
+    }[];
+    layers: {
+        data: number[];
+        height: number;
+        width: number;
+        type: string;
+    }[];
+    tilesets: {
+        columns: number;
+        firstgid: number;
+        image: string;
+        name: string;
+    }[];
+    tileheight: number;
+    tilewidth: number;
+}
+
+export interface WorldData {
+    name: string;
+    tilemap: Tilemap | null;
+}